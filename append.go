@@ -0,0 +1,33 @@
+package rekwest
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AppendInto returns a target for `Do` that appends the items decoded from
+// a response to the slice the given pointer points to, e.g. for collecting
+// the items of all pages of a paginated API into a single slice. The target
+// can be passed to all requests fetching a page. Items of a response are
+// only appended in case all of them were decoded successfully.
+func AppendInto(slice interface{}) interface{} {
+	return &appendTarget{slice: reflect.ValueOf(slice)}
+}
+
+type appendTarget struct {
+	slice reflect.Value
+}
+
+// page returns a pointer to a new, empty slice a single response is
+// decoded into.
+func (a *appendTarget) page() (interface{}, error) {
+	if a.slice.Kind() != reflect.Ptr || a.slice.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("expected pointer to slice, encountered %v when appending into target", a.slice.Type())
+	}
+	return reflect.New(a.slice.Elem().Type()).Interface(), nil
+}
+
+func (a *appendTarget) append(page interface{}) {
+	items := reflect.ValueOf(page).Elem()
+	a.slice.Elem().Set(reflect.AppendSlice(a.slice.Elem(), items))
+}
@@ -0,0 +1,66 @@
+package rekwest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendInto(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"ok":true,"animal":"platypus"},{"ok":true,"animal":"echidna"}]`,
+		"2": `[{"ok":false,"animal":"kangaroo"}]`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		if page == "1" {
+			w.Header().Set("Link", `</?page=2>; rel="next"`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(pages[page]))
+	}))
+	defer ts.Close()
+
+	var animals []responseType
+	target := AppendInto(&animals)
+	next := "/?page=1"
+	for next != "" {
+		r := New(ts.URL + next)
+		if err := r.Do(target); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		next = strings.TrimSuffix(strings.TrimPrefix(r.ResponseHeaders().Get("Link"), "<"), `>; rel="next"`)
+	}
+
+	expected := []responseType{
+		{OK: true, Animal: "platypus"},
+		{OK: true, Animal: "echidna"},
+		{OK: false, Animal: "kangaroo"},
+	}
+	if !reflect.DeepEqual(expected, animals) {
+		t.Errorf("Expected %v, got %v", expected, animals)
+	}
+
+	t.Run("invalid page", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"ok":true,"animal":"wombat"},{"ok":"maybe"}]`))
+		}))
+		defer ts.Close()
+
+		if err := New(ts.URL).Do(target); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if len(animals) != 3 {
+			t.Errorf("Expected partial page not to be appended, got %v", animals)
+		}
+	})
+	t.Run("no slice", func(t *testing.T) {
+		var animal responseType
+		if err := New(ts.URL + "/?page=2").Do(AppendInto(&animal)); err == nil {
+			t.Error("Expected error, got nil")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package rekwest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsetReader returns a reader that decodes input from the given charset
+// into UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso_8859-1", "iso8859-1", "latin1", "l1":
+		return &latin1Reader{src: bufio.NewReader(input)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+}
+
+// responseCharset returns the charset parameter of the given content type.
+func responseCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// latin1Reader decodes ISO-8859-1 encoded data into UTF-8.
+type latin1Reader struct {
+	src     *bufio.Reader
+	scratch [utf8.UTFMax]byte
+	pending []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(l.pending) == 0 {
+			if n > 0 && l.src.Buffered() == 0 {
+				break
+			}
+			b, err := l.src.ReadByte()
+			if err != nil {
+				if n > 0 {
+					return n, nil
+				}
+				return 0, err
+			}
+			l.pending = l.scratch[:utf8.EncodeRune(l.scratch[:], rune(b))]
+		}
+		copied := copy(p[n:], l.pending)
+		l.pending = l.pending[copied:]
+		n += copied
+	}
+	return n, nil
+}
@@ -1,15 +1,21 @@
 package rekwest
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,16 +23,94 @@ type request struct {
 	client *http.Client
 
 	multiErr MultiError
+	strict   bool
 
 	url            string
+	defaultScheme  string
+	query          url.Values
+	defaultQuery   url.Values
+	defaultHeader  http.Header
 	method         string
+	methodSet      bool
 	body           io.Reader
+	bodyProvider   func() (io.ReadCloser, error)
+	contentType    string
 	header         http.Header
+	propagators    []Propagator
+	preRequest     []func(*http.Request) error
 	basicAuth      *credentials
 	bearerToken    string
+	cookies        []*http.Cookie
 	context        context.Context
 	responseFormat ResponseFormat
 	timeout        *time.Duration
+	decodeTimeout  *time.Duration
+	timeoutRatio   float64
+	breaker        Breaker
+	replay         *replay
+	retries        int
+	backoffBase    time.Duration
+	backoffFactor  float64
+	retryOn        []int
+	retryIf        func(*http.Response, error) bool
+	retryOnBody    func([]byte) bool
+	retryOnErrors  []error
+
+	// in memory request bodies that can be sent repeatedly
+	bodyBytes         []byte
+	pooledBody        *pooledBody
+	bodyReleased      bool
+	compress          bool
+	compressOver      int
+	compressMultipart bool
+
+	multipart *multipartBuilder
+
+	unwrap           string
+	verifyDigest     bool
+	requestID        string
+	requestIDEcho    string
+	validators       []func([]byte) error
+	maxBytes         int64
+	maxHeaders       int
+	errorFormatter   func(int, []byte) error
+	acceptStatus     []int
+	decodeBufferSize int
+	response         *http.Response
+	responseBody     []byte
+	into             *Response
+
+	trace  *Timing
+	timing Timing
+	debug  io.Writer
+	har    *harRecorder
+
+	transport       transportConfig
+	transportClient *http.Client
+	jar             http.CookieJar
+}
+
+type replay struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (c *replay) response() *http.Response {
+	header := http.Header{}
+	for key, values := range c.header {
+		header[key] = append([]string(nil), values...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.status, http.StatusText(c.status)),
+		StatusCode:    c.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+	}
 }
 
 func (r *request) Errors() []error {
@@ -37,19 +121,90 @@ func (r *request) OK() bool {
 	return len(r.multiErr.Errors) == 0
 }
 
+func (r *request) StrictBuild() Rekwest {
+	r.strict = true
+	if !r.OK() {
+		panic(fmt.Errorf("could not build request: %w", r.multiErr.Errors[0]))
+	}
+	return r
+}
+
+// buildError records errors that occurred when building the request,
+// panicking right away in strict mode.
+func (r *request) buildError(errs ...error) {
+	r.multiErr.append(phaseBuild, errs...)
+	if r.strict && len(errs) != 0 {
+		panic(fmt.Errorf("could not build request: %w", errs[0]))
+	}
+}
+
+func (r *request) StatusCode() int {
+	if r.response == nil {
+		return 0
+	}
+	return r.response.StatusCode
+}
+
+func (r *request) ResponseBody() []byte {
+	if r.responseBody == nil {
+		return nil
+	}
+	return append([]byte(nil), r.responseBody...)
+}
+
+func (r *request) ResponseHeaders() http.Header {
+	if r.response == nil {
+		return nil
+	}
+	return r.response.Header.Clone()
+}
+
+func (r *request) ResponseCookies() []*http.Cookie {
+	if r.response == nil {
+		return nil
+	}
+	return r.response.Cookies()
+}
+
 func (r *request) Method(m string) Rekwest {
+	if !validMethod(m) {
+		r.buildError(fmt.Errorf("invalid method %q", m))
+		return r
+	}
 	r.method = m
+	r.methodSet = true
 	return r
 }
 
+// validMethod reports whether the given method is a token as defined by
+// RFC 7230, which includes extension methods like PROPFIND or REPORT.
+func validMethod(m string) bool {
+	if m == "" {
+		return false
+	}
+	for _, c := range m {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (r *request) BytesBody(data []byte) Rekwest {
-	return r.Body(bytes.NewReader(data))
+	r.Body(nil)
+	r.bodyBytes = data
+	return r
 }
 
 func (r *request) MarshalBody(data interface{}, marshalFunc func(interface{}) ([]byte, error)) Rekwest {
+	start := time.Now()
 	b, err := marshalFunc(data)
+	r.timing.Marshal = time.Since(start)
 	if err != nil {
-		r.multiErr.append(err)
+		r.buildError(err)
 	} else {
 		return r.BytesBody(b)
 	}
@@ -57,32 +212,228 @@ func (r *request) MarshalBody(data interface{}, marshalFunc func(interface{}) ([
 }
 
 func (r *request) JSONBody(data interface{}) Rekwest {
-	r.Header("Content-Type", contentTypeJSON)
-	return r.MarshalBody(data, json.Marshal)
+	r.contentType = contentTypeJSON
+	return r.encodeBody(data, encodeJSON)
+}
+
+func encodeJSON(buf *bytes.Buffer, data interface{}) error {
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
+		return err
+	}
+	// json.Encoder terminates each value with a newline that json.Marshal
+	// would not add
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+func (r *request) JSONBodyTagged(data interface{}, tagKey string) Rekwest {
+	value, err := taggedValue(reflect.ValueOf(data), tagKey)
+	if err != nil {
+		r.buildError(err)
+		return r
+	}
+	return r.JSONBody(value)
 }
 
 func (r *request) XMLBody(data interface{}) Rekwest {
-	r.Header("Content-Type", contentTypeXML)
-	return r.MarshalBody(data, xml.Marshal)
+	r.contentType = contentTypeXML
+	return r.encodeBody(data, encodeXML)
+}
+
+func encodeXML(buf *bytes.Buffer, data interface{}) error {
+	return xml.NewEncoder(buf).Encode(data)
+}
+
+func (r *request) FormBody(values url.Values) Rekwest {
+	r.contentType = contentTypeForm
+	return r.BytesBody([]byte(values.Encode()))
 }
 
+// encodeBody encodes the given data into a pooled buffer that is used as the
+// request body. The buffer is returned to the pool once `Do` has completed
+// and the transport is done sending it.
+func (r *request) encodeBody(data interface{}, encode func(*bytes.Buffer, interface{}) error) Rekwest {
+	start := time.Now()
+	body, err := newPooledBody(data, encode)
+	r.timing.Marshal = time.Since(start)
+	if err != nil {
+		r.buildError(err)
+		return r
+	}
+	r.Body(nil)
+	r.pooledBody = body
+	return r
+}
+
+// releaseBody releases a pooled request body. As the underlying buffer is
+// going to be reused, the body cannot be sent again afterwards.
+func (r *request) releaseBody() {
+	if r.pooledBody != nil {
+		r.pooledBody.release()
+		r.pooledBody = nil
+	}
+}
+
+// errBodyReleased is returned when sending a request again after its pooled
+// body has been released by a previous call to `Do`.
+var errBodyReleased = errors.New("request body has been released after being sent, set it again for sending it another time")
+
 func (r *request) Body(b io.Reader) Rekwest {
+	r.releaseBody()
+	r.bodyReleased = false
+	r.bodyBytes = nil
+	r.multipart = nil
+	r.bodyProvider = nil
 	r.body = b
 	return r
 }
 
+func (r *request) BodyProvider(provide func() (io.ReadCloser, error)) Rekwest {
+	r.Body(nil)
+	r.bodyProvider = provide
+	return r
+}
+
+func (r *request) ResetBody() Rekwest {
+	r.contentType = ""
+	return r.Body(nil)
+}
+
+func (r *request) ChannelBody(ch <-chan []byte, errs <-chan error) Rekwest {
+	return r.Body(&channelReader{ch: ch, errs: errs, closed: make(chan struct{})})
+}
+
+// channelReader streams the byte slices received from a channel. It returns
+// io.EOF once the channel is closed and all received data has been read, or
+// the first error received from the producer. Reading is aborted once the
+// reader is closed or the context of the attempt sending it is done.
+type channelReader struct {
+	ch      <-chan []byte
+	errs    <-chan error
+	pending []byte
+
+	mu        sync.Mutex
+	ctx       context.Context
+	err       error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// bind ensures reading is aborted once the given context is done.
+func (c *channelReader) bind(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = ctx
+}
+
+func (c *channelReader) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	ctx, err := c.ctx, c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	for len(c.pending) == 0 {
+		select {
+		case chunk, ok := <-c.ch:
+			if !ok {
+				// an error sent before closing the channel still fails the body
+				select {
+				case err := <-c.errs:
+					if err != nil {
+						return 0, c.fail(err)
+					}
+				default:
+				}
+				return 0, io.EOF
+			}
+			c.pending = chunk
+		case err, ok := <-c.errs:
+			if !ok {
+				c.errs = nil
+				continue
+			}
+			if err != nil {
+				return 0, c.fail(err)
+			}
+		case <-c.closed:
+			return 0, io.ErrClosedPipe
+		case <-done:
+			return 0, ctx.Err()
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *channelReader) fail(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = fmt.Errorf("error producing request body: %w", err)
+	return c.err
+}
+
+// Close unblocks pending reads, as the transport closes the body when the
+// request fails or is canceled.
+func (c *channelReader) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *channelReader) sourceErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// sourceBody is implemented by request bodies reading from a source given by
+// the caller. Errors of the source are not caused by the transport, so they
+// are reported as build errors and are neither retried nor counted as a
+// failure.
+type sourceBody interface {
+	sourceErr() error
+}
+
 func (r *request) Header(key, value string) Rekwest {
-	r.header.Add(key, value)
+	r.headers(1).Add(key, value)
 	return r
 }
 
 func (r *request) Headers(headers map[string]string) Rekwest {
+	h := r.headers(len(headers))
 	for key, value := range headers {
-		r.header.Add(key, value)
+		h.Add(key, value)
+	}
+	return r
+}
+
+func (r *request) SetHeaders(header http.Header) Rekwest {
+	h := r.headers(len(header))
+	for key, values := range header {
+		for _, value := range values {
+			h.Add(key, value)
+		}
 	}
 	return r
 }
 
+// headers returns the request's header, allocating it with room for the
+// given number of keys on first use, so requests without custom headers do
+// not need to allocate one at all.
+func (r *request) headers(size int) http.Header {
+	if r.header == nil {
+		r.header = make(http.Header, size)
+	}
+	return r.header
+}
+
 type credentials struct {
 	userName, password string
 }
@@ -92,6 +443,149 @@ func (r *request) BasicAuth(username, password string) Rekwest {
 	return r
 }
 
+func (r *request) AcceptCharset(charsets ...string) Rekwest {
+	r.headers(1).Set("Accept-Charset", qualityValues(charsets))
+	return r
+}
+
+func (r *request) AcceptLanguage(langs ...string) Rekwest {
+	r.headers(1).Set("Accept-Language", qualityValues(langs))
+	return r
+}
+
+// qualityValues joins the given values in order of preference, assigning
+// decreasing quality values to all but the first one.
+func qualityValues(values []string) string {
+	weighted := make([]string, len(values))
+	for i, value := range values {
+		switch {
+		case i == 0:
+			weighted[i] = value
+		case i < 10:
+			weighted[i] = fmt.Sprintf("%s;q=0.%d", value, 10-i)
+		default:
+			weighted[i] = fmt.Sprintf("%s;q=0.1", value)
+		}
+	}
+	return strings.Join(weighted, ", ")
+}
+
+func (r *request) Priority(weight int) Rekwest {
+	switch {
+	case weight < 1:
+		weight = 1
+	case weight > 256:
+		weight = 256
+	}
+	urgency := 7 - (weight-1)*8/256
+	r.headers(1).Set("Priority", fmt.Sprintf("u=%d", urgency))
+	return r
+}
+
+func (r *request) DefaultScheme(scheme string) Rekwest {
+	r.defaultScheme = scheme
+	return r
+}
+
+func (r *request) Path(segments ...string) Rekwest {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		r.buildError(err)
+		return r
+	}
+	if err := joinURLPath(u, segments...); err != nil {
+		r.buildError(err)
+		return r
+	}
+	r.url = u.String()
+	return r
+}
+
+// joinURLPath appends the given segments to the path of u, separated by a
+// single slash. Segments are appended as is, so the existing path prefix is
+// kept, which is why dot segments are rejected instead of being resolved.
+// Characters that need escaping are escaped, while escaped characters are
+// kept escaped.
+func joinURLPath(u *url.URL, segments ...string) error {
+	var parts []string
+	for _, segment := range segments {
+		for _, part := range strings.Split(segment, "/") {
+			if part == "" {
+				continue
+			}
+			unescaped, err := url.PathUnescape(part)
+			if err != nil {
+				return fmt.Errorf("invalid path segment %q: %w", segment, err)
+			}
+			if unescaped == "." || unescaped == ".." {
+				return fmt.Errorf("invalid path segment %q: dot segments are not allowed", segment)
+			}
+			parts = append(parts, part)
+		}
+	}
+	joined := u.EscapedPath()
+	if len(parts) != 0 {
+		joined = strings.Join(parts, "/")
+		if base := u.EscapedPath(); base != "" {
+			joined = strings.TrimSuffix(base, "/") + "/" + joined
+		}
+	}
+	// trailing slashes may be significant
+	if len(segments) != 0 && strings.HasSuffix(segments[len(segments)-1], "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	unescaped, err := url.PathUnescape(joined)
+	if err != nil {
+		return fmt.Errorf("invalid path %q: %w", joined, err)
+	}
+	u.Path, u.RawPath = unescaped, joined
+	return nil
+}
+
+func (r *request) Query(key, value string) Rekwest {
+	if r.query == nil {
+		r.query = url.Values{}
+	}
+	r.query.Add(key, value)
+	return r
+}
+
+func (r *request) QueryValues(key string, values []string) Rekwest {
+	for _, value := range values {
+		r.Query(key, value)
+	}
+	return r
+}
+
+func (r *request) IfUnmodifiedSince(t time.Time) Rekwest {
+	r.headers(1).Set("If-Unmodified-Since", t.UTC().Format(http.TimeFormat))
+	return r
+}
+
+func (r *request) Prefer(value string) Rekwest {
+	return r.Header("Prefer", value)
+}
+
+func (r *request) PreRequest(hook func(*http.Request) error) Rekwest {
+	r.preRequest = append(r.preRequest, hook)
+	return r
+}
+
+func (r *request) Cookie(cookie *http.Cookie) Rekwest {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+func (r *request) Cookies(cookies ...*http.Cookie) Rekwest {
+	r.cookies = append(r.cookies, cookies...)
+	return r
+}
+
+func (r *request) UserAgent(agent string) Rekwest {
+	r.headers(1).Set("User-Agent", agent)
+	return r
+}
+
 func (r *request) BearerToken(token string) Rekwest {
 	r.bearerToken = token
 	return r
@@ -102,135 +596,1013 @@ func (r *request) Context(ctx context.Context) Rekwest {
 	return r
 }
 
+func (r *request) WithValue(key, value interface{}) Rekwest {
+	r.context = context.WithValue(r.context, key, value)
+	return r
+}
+
 func (r *request) ResponseFormat(format ResponseFormat) Rekwest {
+	// the Accept header is replaced, so overriding a default format does not
+	// leave the previous value in place
 	switch format {
 	case ResponseFormatJSON:
-		r.Header("Accept", acceptJSON)
+		r.headers(1).Set("Accept", acceptJSON)
 	case ResponseFormatXML:
-		r.Header("Accept", acceptXML)
+		r.headers(1).Set("Accept", acceptXML)
 	}
 	r.responseFormat = format
 	return r
 }
 
+func (r *request) DecodeBufferSize(size int) Rekwest {
+	r.decodeBufferSize = size
+	return r
+}
+
+func (r *request) Unwrap(key string) Rekwest {
+	r.unwrap = key
+	return r
+}
+
+func (r *request) ErrorFormatter(format func(status int, body []byte) error) Rekwest {
+	r.errorFormatter = format
+	return r
+}
+
+func (r *request) MaxResponseBytes(limit int64) Rekwest {
+	r.maxBytes = limit
+	return r
+}
+
+func (r *request) MaxResponseHeaders(limit int) Rekwest {
+	r.maxHeaders = limit
+	return r
+}
+
+// verifyHeaderCount fails in case the response has more header fields than
+// allowed, counting each value of a repeated header separately.
+func (r *request) verifyHeaderCount(res *http.Response) error {
+	if r.maxHeaders <= 0 {
+		return nil
+	}
+	var count int
+	for _, values := range res.Header {
+		count += len(values)
+	}
+	if count > r.maxHeaders {
+		return fmt.Errorf("response has %d header fields, exceeding limit of %d", count, r.maxHeaders)
+	}
+	return nil
+}
+
+// limitedBody fails reading once more than limit bytes have been read.
+type limitedBody struct {
+	io.ReadCloser
+	limit, read int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, l.exceeded()
+	}
+	// reading a single byte past the limit is sufficient for detecting
+	// an oversized body
+	if remaining := l.limit - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), l.exceeded()
+	}
+	return n, err
+}
+
+func (l *limitedBody) exceeded() error {
+	return fmt.Errorf("response body exceeded limit of %d bytes, read %d bytes before truncating", l.limit, l.read)
+}
+
+func (r *request) VerifyDigest() Rekwest {
+	r.verifyDigest = true
+	return r
+}
+
+func (r *request) Validate(validate func([]byte) error) Rekwest {
+	r.validators = append(r.validators, validate)
+	return r
+}
+
 func (r *request) Timeout(value time.Duration) Rekwest {
 	r.timeout = &value
 	return r
 }
 
+func (r *request) TimeoutFraction(f float64) Rekwest {
+	switch {
+	case f < 0:
+		f = 0
+	case f > 1:
+		f = 1
+	}
+	r.timeoutRatio = f
+	return r
+}
+
+func (r *request) Replay(status int, header http.Header, body []byte) Rekwest {
+	r.replay = &replay{status, header, body}
+	return r
+}
+
+func (r *request) Trace(timing *Timing) Rekwest {
+	r.trace = timing
+	return r
+}
+
+func (r *request) DebugOnError(w io.Writer) Rekwest {
+	r.debug = w
+	return r
+}
+
+// finish is called when performing the request has completed with the
+// given error. It reports timings and debug output and releases the body.
+func (r *request) finish(err error) {
+	if r.trace != nil {
+		*r.trace = r.timing
+	}
+	if err != nil && r.debug != nil {
+		r.writeDebug(err)
+	}
+	if r.har != nil && r.response != nil {
+		r.writeHAR()
+	}
+	r.populateInto()
+	if r.pooledBody != nil {
+		r.releaseBody()
+		r.bodyReleased = true
+	}
+}
+
+// writeHAR records the request and response in the HAR log. Requests that
+// cannot be rebuilt are skipped, as recording must not affect the outcome of
+// the request.
+func (r *request) writeHAR() {
+	req := r.response.Request
+	if req == nil {
+		built, err := r.buildRequest(r.method, r.url, nil)
+		if err != nil {
+			return
+		}
+		req = built
+	}
+	body := r.bodyBytes
+	if r.pooledBody != nil {
+		body = r.pooledBody.buf.Bytes()
+	}
+	r.har.record(req, body, r.response)
+}
+
+// writeDebug writes the error, a redacted curl command reproducing the
+// request and the measured timings to the debug writer.
+func (r *request) writeDebug(err error) {
+	fmt.Fprintf(r.debug, "rekwest: %v\n", err)
+	req, buildErr := r.buildRequest(r.method, r.url, nil)
+	if buildErr != nil {
+		fmt.Fprintf(r.debug, "rekwest: could not build request for debugging: %v\n", buildErr)
+	} else {
+		body := r.bodyBytes
+		if r.pooledBody != nil {
+			body = r.pooledBody.buf.Bytes()
+		}
+		fmt.Fprintf(r.debug, "%s\n", curlCommand(req, body))
+	}
+	fmt.Fprintf(r.debug, "marshal=%v headers=%v decode=%v\n", r.timing.Marshal, r.timing.Headers, r.timing.Decode)
+}
+
+func (r *request) CircuitBreaker(breaker Breaker) Rekwest {
+	r.breaker = breaker
+	return r
+}
+
 func (r *request) Client(client *http.Client) Rekwest {
 	r.client = client
+	r.transportClient = nil
+	return r
+}
+
+func (r *request) CookieJar(jar http.CookieJar) Rekwest {
+	r.jar = jar
+	r.transportClient = nil
 	return r
 }
 
 type doResult struct {
-	res *http.Response
-	err error
+	res     *http.Response
+	err     error
+	phase   errorPhase
+	headers time.Duration
 }
 
-func (r *request) Do(targets ...interface{}) error {
+func (r *request) Do(targets ...interface{}) (err error) {
+	defer func() {
+		r.finish(err)
+	}()
+
 	if !r.OK() {
-		return fmt.Errorf("could not perform request: %v", r.multiErr)
+		return fmt.Errorf("could not perform request: %w", r.multiErr)
 	}
 
-	timeout := context.Background()
-	if r.timeout != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), *r.timeout)
-		timeout = ctx
-		defer cancel()
+	timeout, cancel := r.timeoutContext()
+	defer cancel()
+
+	res, err := r.perform(timeout, r.newRequest)
+	if err != nil {
+		return err
 	}
+	r.response = res
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if r.into != nil && r.into.Target != nil {
+		targets = append(targets, r.into.Target)
+	}
+	return r.handleResponse(timeout, res, targets)
+}
 
-	receive := make(chan doResult)
+func (r *request) DoJSON(body, target interface{}) error {
+	if !r.methodSet {
+		r.Method(http.MethodPost)
+	}
+	r.JSONBody(body).ResponseFormat(ResponseFormatJSON)
+	if target == nil {
+		return r.Do()
+	}
+	return r.Do(target)
+}
 
-	go func() {
-		req, reqErr := http.NewRequest(r.method, r.url, r.body)
-		if reqErr != nil {
-			receive <- doResult{nil, reqErr}
-			return
+func (r *request) PollUntil(target interface{}, interval time.Duration, done func(*http.Response) bool) (err error) {
+	defer func() {
+		r.finish(err)
+	}()
+
+	if !r.OK() {
+		return fmt.Errorf("could not perform request: %w", r.multiErr)
+	}
+
+	if done == nil {
+		done = func(res *http.Response) bool {
+			return res.StatusCode != http.StatusAccepted
+		}
+	}
+
+	var targets []interface{}
+	if target != nil {
+		targets = append(targets, target)
+	}
+
+	timeout, cancel := r.timeoutContext()
+	defer cancel()
+
+	build := r.newRequest
+	var pollURL string
+	for {
+		res, err := r.perform(timeout, build)
+		if err != nil {
+			return err
+		}
+		if done(res) {
+			r.response = res
+			if res.Body != nil {
+				defer res.Body.Close()
+			}
+			return r.handleResponse(timeout, res, targets)
+		}
+
+		location, err := res.Location()
+		if res.Body != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		if err == nil {
+			pollURL = location.String()
+		} else if pollURL == "" {
+			return fmt.Errorf("could not poll for completion: %v", err)
+		}
+
+		select {
+		case <-timeout.Done():
+			return timeout.doneErr(r.context)
+		case <-time.After(interval):
 		}
-		for key, value := range r.header {
-			req.Header.Set(key, value[0])
+
+		next := pollURL
+		build = func() (*http.Request, error) {
+			return r.newPollRequest(next)
 		}
+	}
+}
+
+// requestTimeout is a context that is done when either the effective timeout
+// of a request has passed or the request's context is done. Both are merged
+// into a single context, so comparing their deadlines tells which one came
+// first.
+type requestTimeout struct {
+	context.Context
+	value *time.Duration
+	// deadline is the time the effective timeout passes, if set.
+	deadline time.Time
+	// budget is the time that has been remaining until the deadline of
+	// the request's context when starting to perform the request.
+	budget time.Duration
+	// decode is the timeout for reading and decoding the response, if set.
+	decode         *time.Duration
+	decodeDeadline time.Time
+}
+
+func (t requestTimeout) err() error {
+	return fmt.Errorf("exceeded request timeout of %v", t.value)
+}
+
+// doneErr returns the error for t being done, depending on whether one of
+// the timeouts or the given request context has caused it. Like
+// context.WithDeadline, merged contexts expire at the earliest of their
+// deadlines, so that one is the cause of exceeding it.
+func (t requestTimeout) doneErr(ctx context.Context) error {
+	if errors.Is(t.Err(), context.DeadlineExceeded) {
+		parent, _ := ctx.Deadline()
+		switch {
+		case expiresFirst(t.decodeDeadline, t.deadline) && expiresFirst(t.decodeDeadline, parent):
+			return fmt.Errorf("exceeded decode timeout of %v", t.decode)
+		case expiresFirst(t.deadline, parent):
+			return t.err()
+		}
+	}
+	return t.contextErr(ctx)
+}
+
+// expiresFirst returns whether the given deadline is set and passes before
+// the other one, which is zero in case it is not set.
+func expiresFirst(deadline, other time.Time) bool {
+	return !deadline.IsZero() && (other.IsZero() || deadline.Before(other))
+}
+
+// contextErr returns the error for the given request context being done,
+// including the deadline's budget if known.
+func (t requestTimeout) contextErr(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) && t.budget > 0 {
+		return fmt.Errorf("provided context was cancelled: %w after ~%v", err, t.budget.Round(time.Millisecond))
+	}
+	return fmt.Errorf("provided context was cancelled: %w", err)
+}
+
+// timeoutContext returns a context that is done when the effective
+// timeout has passed or the request's context is done.
+func (r *request) timeoutContext() (requestTimeout, context.CancelFunc) {
+	now := time.Now()
+	var budget time.Duration
+	if deadline, ok := r.context.Deadline(); ok {
+		budget = deadline.Sub(now)
+	}
+	if value := r.effectiveTimeout(now); value != nil {
+		deadline := now.Add(*value)
+		ctx, cancel := context.WithDeadline(r.context, deadline)
+		return requestTimeout{Context: ctx, value: value, deadline: deadline, budget: budget}, cancel
+	}
+	ctx, cancel := context.WithCancel(r.context)
+	return requestTimeout{Context: ctx, budget: budget}, cancel
+}
+
+// decodeContext returns a requestTimeout that is additionally bounded by the
+// decode timeout if set, which starts once the response has been received.
+func (r *request) decodeContext(timeout requestTimeout) (requestTimeout, context.CancelFunc) {
+	if r.decodeTimeout == nil {
+		return timeout, func() {}
+	}
+	deadline := time.Now().Add(*r.decodeTimeout)
+	ctx, cancel := context.WithDeadline(timeout, deadline)
+	timeout.Context = ctx
+	timeout.decode = r.decodeTimeout
+	timeout.decodeDeadline = deadline
+	return timeout, cancel
+}
 
-		if r.basicAuth != nil {
-			req.SetBasicAuth(r.basicAuth.userName, r.basicAuth.password)
+func (r *request) DecodeTimeout(d time.Duration) Rekwest {
+	r.decodeTimeout = &d
+	return r
+}
+
+func (r *request) EffectiveDeadline() (time.Time, bool) {
+	now := time.Now()
+	deadline, ok := r.context.Deadline()
+	if timeout := r.effectiveTimeout(now); timeout != nil {
+		if timeoutDeadline := now.Add(*timeout); !ok || timeoutDeadline.Before(deadline) {
+			return timeoutDeadline, true
 		}
+	}
+	return deadline, ok
+}
 
-		if r.bearerToken != "" {
-			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.bearerToken))
+// effectiveTimeout returns the timeout to use when performing the request
+// at the given time. In case a timeout fraction is set and the request's
+// context has a deadline, the fraction of the remaining time is used unless
+// the configured timeout is shorter.
+func (r *request) effectiveTimeout(now time.Time) *time.Duration {
+	timeout := r.timeout
+	if r.timeoutRatio == 0 {
+		return timeout
+	}
+	if deadline, ok := r.context.Deadline(); ok {
+		fraction := time.Duration(float64(deadline.Sub(now)) * r.timeoutRatio)
+		if fraction < 0 {
+			fraction = 0
+		}
+		if timeout == nil || fraction < *timeout {
+			timeout = &fraction
 		}
-		res, err := r.client.Do(req)
-		receive <- doResult{res, err}
+	}
+	return timeout
+}
+
+func (r *request) newRequest() (*http.Request, error) {
+	if r.bodyReleased {
+		return nil, errBodyReleased
+	}
+	if r.multipart != nil {
+		return r.newMultipartRequest()
+	}
+	if r.bodyProvider != nil {
+		return r.newProvidedRequest()
+	}
+	req, err := r.buildRequest(r.method, r.url, r.body)
+	if err != nil {
+		return nil, err
+	}
+
+	// in memory bodies can be sent again when following 307 and 308
+	// redirects or when the transport retries the request
+	compressed, err := r.compressedBody()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case compressed != nil:
+		req.Header.Set("Content-Encoding", "gzip")
+		setReplayableBody(req, len(compressed), func() io.ReadCloser {
+			return ioutil.NopCloser(bytes.NewReader(compressed))
+		})
+	case r.pooledBody != nil:
+		body := r.pooledBody
+		setReplayableBody(req, body.buf.Len(), body.reader)
+	case r.bodyBytes != nil:
+		data := r.bodyBytes
+		setReplayableBody(req, len(data), func() io.ReadCloser {
+			return ioutil.NopCloser(bytes.NewReader(data))
+		})
+	}
+	return req, nil
+}
+
+// newProvidedRequest builds a request streaming a fresh body obtained from
+// the body provider, which is also used when the body needs to be sent again.
+func (r *request) newProvidedRequest() (*http.Request, error) {
+	body, err := r.bodyProvider()
+	if err != nil {
+		return nil, fmt.Errorf("error providing request body: %w", err)
+	}
+	req, err := r.buildRequest(r.method, r.url, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	req.GetBody = r.bodyProvider
+	return req, nil
+}
+
+func setReplayableBody(req *http.Request, length int, open func() io.ReadCloser) {
+	if length == 0 {
+		req.ContentLength = 0
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+		return
+	}
+	req.ContentLength = int64(length)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return open(), nil
+	}
+	req.Body = open()
+}
+
+func (r *request) buildRequest(method, rawURL string, body io.Reader) (*http.Request, error) {
+	// protocol-relative URLs use the default scheme
+	if strings.HasPrefix(rawURL, "//") {
+		scheme := r.defaultScheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		rawURL = scheme + ":" + rawURL
+	}
+	if len(r.query) != 0 || len(r.defaultQuery) != 0 {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		for key, values := range r.query {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		// defaults only apply to keys that have not been given otherwise
+		for key, values := range r.defaultQuery {
+			if _, ok := query[key]; !ok {
+				query[key] = append([]string(nil), values...)
+			}
+		}
+		u.RawQuery = query.Encode()
+		rawURL = u.String()
+	}
+	return r.headerRequest(method, rawURL, body, r.contentType)
+}
+
+// newPollRequest builds the GET request polling the given URL, which is used
+// as given, so the query is not added again. It has no body, so none of the
+// headers describing the body are sent.
+func (r *request) newPollRequest(rawURL string) (*http.Request, error) {
+	req, err := r.headerRequest(http.MethodGet, rawURL, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Del("Content-Type")
+	req.Header.Del("Content-Encoding")
+	return req, nil
+}
+
+// headerRequest creates a request for the given URL, adding the request's
+// headers, credentials and cookies. The given content type is sent unless
+// one has been set explicitly.
+func (r *request) headerRequest(method, rawURL string, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(r.context, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range r.header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	for _, p := range r.propagators {
+		p.Inject(req.Context(), req.Header)
+	}
+
+	// the content type implied by the body is only used in case none has
+	// been set explicitly
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if r.basicAuth != nil {
+		req.SetBasicAuth(r.basicAuth.userName, r.basicAuth.password)
+	}
+
+	if r.bearerToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.bearerToken))
+	}
+
+	// defaults only apply to headers that have not been set otherwise,
+	// including the ones implied by the body or credentials
+	for key, values := range r.defaultHeader {
+		if _, ok := req.Header[key]; !ok {
+			req.Header[key] = append([]string(nil), values...)
+		}
+	}
+
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+	return req, nil
+}
+
+// perform sends a request unless it is replayed, retrying it if configured.
+func (r *request) perform(timeout requestTimeout, build func() (*http.Request, error)) (*http.Response, error) {
+	if r.har != nil {
+		r.har.begin()
+	}
+	if r.replay != nil {
+		return r.replay.response(), nil
+	}
+	// all ways of sending a request are counted, including retries and
+	// waiting for them
+	atomic.AddInt64(&inFlight, 1)
+	defer atomic.AddInt64(&inFlight, -1)
+	return r.retry(timeout, func() (*http.Response, error) {
+		return r.attempt(timeout, build)
+	})
+}
+
+// attempt sends a request unless the circuit breaker is open, recording the
+// outcome with the circuit breaker if given.
+func (r *request) attempt(timeout requestTimeout, build func() (*http.Request, error)) (*http.Response, error) {
+	if r.breaker == nil {
+		return r.send(timeout, build)
+	}
+
+	if !r.breaker.Allow() {
+		return nil, ErrCircuitOpen
+	}
+	res, err := r.send(timeout, build)
+	var multiErr MultiError
+	switch {
+	case errors.As(err, &multiErr) && len(multiErr.BuildErrors()) != 0:
+		// the request has never been sent
+	case errors.Is(err, context.Canceled):
+		// the caller gave up on the request
+	case err != nil, res.StatusCode >= http.StatusInternalServerError:
+		r.breaker.RecordFailure()
+	default:
+		r.breaker.RecordSuccess()
+	}
+	return res, err
+}
+
+// send builds and sends a request, waiting for the response until either
+// the given timeout or the request's context is done. In that case, the
+// request is canceled so the transport tears down its connection.
+func (r *request) send(timeout requestTimeout, build func() (*http.Request, error)) (*http.Response, error) {
+	// the result is buffered, so sending it does not block once the caller
+	// has stopped waiting
+	receive := make(chan doResult, 1)
+	// the request is sent using the timeout's context, which is merged with
+	// the request's context, so either of them cancels in-flight I/O
+	ctx, cancel := context.WithCancel(timeout)
+
+	go func() {
+		start := time.Now()
+		req, err := build()
+		headers := time.Since(start)
+		if err != nil {
+			receive <- doResult{nil, err, phaseBuild, headers}
+			return
+		}
+		for _, hook := range r.preRequest {
+			if err := hook(req); err != nil {
+				receive <- doResult{nil, err, phaseBuild, headers}
+				return
+			}
+		}
+		client, err := r.httpClient()
+		if err != nil {
+			receive <- doResult{nil, err, phaseBuild, headers}
+			return
+		}
+		if body, ok := req.Body.(*channelReader); ok {
+			body.bind(ctx)
+		}
+		var sendCtx context.Context = ctx
+		if r.har != nil {
+			sendCtx = r.har.trace(ctx)
+		}
+		res, err := client.Do(req.WithContext(sendCtx))
+		if body, ok := req.Body.(sourceBody); ok && err != nil {
+			if sourceErr := body.sourceErr(); sourceErr != nil {
+				receive <- doResult{nil, sourceErr, phaseBuild, headers}
+				return
+			}
+		}
+		receive <- doResult{res, err, phaseTransport, headers}
 	}()
 
+	abandon := func() {
+		cancel()
+		go func() {
+			// a response arriving concurrently to the cancellation still
+			// needs its body to be closed for releasing the connection
+			if result := <-receive; result.res != nil {
+				result.res.Body.Close()
+			}
+		}()
+	}
+
 	select {
 	case <-timeout.Done():
-		return fmt.Errorf("exceeded request timeout of %v", r.timeout)
-	case <-r.context.Done():
-		return fmt.Errorf("provided context was cancelled: %v", r.context.Err())
+		abandon()
+		return nil, timeout.doneErr(r.context)
 	case result := <-receive:
+		r.timing.Headers = result.headers
 		if result.err != nil {
-			return fmt.Errorf("error performing the request: %v", result.err)
+			cancel()
+			// the transport might report the cancellation of the request
+			// before the select above does
+			if timeout.Err() != nil {
+				return nil, timeout.doneErr(r.context)
+			}
+			performErr := MultiError{}
+			performErr.append(result.phase, result.err)
+			return nil, fmt.Errorf("error performing the request: %w", performErr)
+		}
+		// the body of a 101 response is the upgraded connection, which
+		// outlives the request
+		if result.res.StatusCode != http.StatusSwitchingProtocols {
+			result.res.Body = &cancelBody{ReadCloser: result.res.Body, cancel: cancel}
 		}
+		return result.res, nil
+	}
+}
 
-		if result.res.Body != nil {
-			defer result.res.Body.Close()
+// cancelBody cancels the context of the request it belongs to when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelBody) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// responsePath returns the path of the URL the response has been received
+// from, which differs from the request's URL when following redirects.
+func (r *request) responsePath(res *http.Response) string {
+	if res.Request != nil && res.Request.URL != nil {
+		return res.Request.URL.Path
+	}
+	if u, err := url.Parse(r.url); err == nil {
+		return u.Path
+	}
+	return ""
+}
+
+func (r *request) AcceptStatus(codes ...int) Rekwest {
+	r.acceptStatus = append(r.acceptStatus, codes...)
+	return r
+}
+
+// errorStatus returns whether a response with the given status is handled
+// as an error, which are all of 400 and above unless accepted explicitly.
+func (r *request) errorStatus(status int) bool {
+	if status < http.StatusBadRequest {
+		return false
+	}
+	for _, code := range r.acceptStatus {
+		if code == status {
+			return false
 		}
+	}
+	return true
+}
 
-		if result.res.StatusCode >= http.StatusBadRequest {
-			b, err := ioutil.ReadAll(result.res.Body)
-			if err != nil {
-				return fmt.Errorf("request failed with status %d: %s", result.res.StatusCode, err)
-			}
-			return fmt.Errorf("request failed with status %d: %s", result.res.StatusCode, string(b))
-		}
-
-		for _, target := range targets {
-			var format targetFormat
-			switch r.responseFormat {
-			case ResponseFormatJSON, ResponseFormatXML, ResponseFormatBytes:
-				format = targetFormat(r.responseFormat)
-			case ResponseFormatContentType:
-				f, err := inferTargetFormat(result.res.Header.Get("Content-Type"))
-				if err != nil {
-					r.multiErr.append(err)
-				} else {
-					format = f
-				}
-			default:
-				r.multiErr.append(fmt.Errorf("found unknown response format %s", r.responseFormat))
+func (r *request) handleResponse(timeout requestTimeout, res *http.Response, targets []interface{}) error {
+	timeout, cancel := r.decodeContext(timeout)
+	defer cancel()
+
+	if err := r.verifyHeaderCount(res); err != nil {
+		r.multiErr.append(phaseDecode, err)
+		return fmt.Errorf("error handling the response: %w", r.multiErr)
+	}
+
+	received := res.Body
+	// the size limit applies to the decompressed body
+	if decompressBody(res) {
+		defer res.Body.Close()
+	}
+	// the decompressed body is recorded, as it matches the recorded headers
+	if r.har != nil && res.Body != nil {
+		res.Body = r.har.tee(res.Body)
+	}
+	if r.maxBytes > 0 {
+		res.Body = &limitedBody{ReadCloser: res.Body, limit: r.maxBytes}
+	}
+
+	if r.errorStatus(res.StatusCode) {
+		b, err := ioutil.ReadAll(res.Body)
+		r.responseBody = b
+		if r.errorFormatter != nil && err == nil {
+			if formatted := r.errorFormatter(res.StatusCode, b); formatted != nil {
+				return formatted
 			}
+		}
+		return &StatusError{Code: res.StatusCode, Body: b, readErr: err}
+	}
 
-			switch format {
-			case targetFormatJSON:
-				if err := json.NewDecoder(result.res.Body).Decode(target); err != nil {
-					r.multiErr.append(err)
-				}
-			case targetFormatXML:
-				if err := xml.NewDecoder(result.res.Body).Decode(target); err != nil {
-					r.multiErr.append(err)
-				}
-			case targetFormatBytes:
-				b, err := ioutil.ReadAll(result.res.Body)
-				if err != nil {
-					r.multiErr.append(err)
-				}
-				v := reflect.ValueOf(target)
-				if k := v.Kind(); k != reflect.Ptr {
-					r.multiErr.append(fmt.Errorf("expected pointer kind, encountered %v when decoding into target element", k))
-					break
-				}
-				if s := v.Elem().Type().String(); s != "[]uint8" {
-					r.multiErr.append(fmt.Errorf("expected byte slice elem, encountered %s when decoding into target element", s))
-					break
-				}
-				v.Elem().Set(reflect.ValueOf(b))
+	if err := r.verifyRequestIDEcho(res); err != nil {
+		r.multiErr.append(phaseDecode, err)
+		return fmt.Errorf("error handling the response: %w", r.multiErr)
+	}
+
+	// the body is buffered once, so it is the single source all targets are
+	// decoded from
+	b, err := r.readBody(timeout, res, received)
+	if err != nil {
+		r.multiErr.append(phaseDecode, err)
+		return fmt.Errorf("error handling the response: %w", r.multiErr)
+	}
+	r.responseBody = b
+
+	// only responses announcing Content-Length: 0 skip decoding, leaving
+	// targets untouched instead of failing with an unexpected EOF. The body
+	// is checked too, as responses built by custom transports report a zero
+	// length for non-empty bodies unless set explicitly.
+	if res.ContentLength == 0 && len(b) == 0 {
+		return nil
+	}
+
+	// without a content type the format is inferred from the first bytes of
+	// the body instead
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" && r.responseFormat == ResponseFormatContentType {
+		contentType = sniffContentType(b)
+	}
+	charset := responseCharset(contentType)
+
+	start := time.Now()
+	defer func() {
+		r.timing.Decode = time.Since(start)
+	}()
+
+	for _, target := range targets {
+		if timeout.Err() != nil {
+			r.multiErr.append(phaseDecode, timeout.doneErr(r.context))
+			break
+		}
+		format := r.responseFormat
+		if hinted, ok := target.(*formatTarget); ok {
+			format, target = hinted.format, hinted.target
+		}
+		if appender, ok := target.(*appendTarget); ok {
+			// each response is decoded into a fresh page, so only complete
+			// pages are appended
+			page, err := appender.page()
+			if err != nil {
+				r.multiErr.append(phaseDecode, err)
+				continue
 			}
+			errs := len(r.multiErr.Errors)
+			r.decodeTarget(res, b, contentType, charset, format, page)
+			if len(r.multiErr.Errors) == errs {
+				appender.append(page)
+			}
+			continue
 		}
+		r.decodeTarget(res, b, contentType, charset, format, target)
 	}
 
 	if !r.OK() {
-		return fmt.Errorf("error handling the response: %v", r.multiErr)
+		return fmt.Errorf("error handling the response: %w", r.multiErr)
 	}
 	return nil
 }
+
+// decodeTarget decodes the given buffered response body onto target using
+// the given response format, collecting errors in the request's MultiError.
+func (r *request) decodeTarget(res *http.Response, b []byte, contentType, charset string, responseFormat ResponseFormat, target interface{}) {
+	text, decoded := r.textReader(b, charset)
+	xmlCharsetReader := charsetReader
+	if decoded {
+		xmlCharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+
+	if unmarshaler, ok := target.(Unmarshaler); ok {
+		b, err := ioutil.ReadAll(text)
+		if err == nil {
+			err = unmarshaler.UnmarshalRekwest(contentType, b)
+		}
+		if err != nil {
+			r.multiErr.append(phaseDecode, err)
+		}
+		return
+	}
+
+	var format targetFormat
+	switch responseFormat {
+	case ResponseFormatJSON, ResponseFormatXML, ResponseFormatBytes:
+		format = targetFormat(responseFormat)
+	case ResponseFormatContentType:
+		f, err := inferTargetFormat(contentType, r.responsePath(res))
+		if err != nil {
+			r.multiErr.append(phaseDecode, err)
+		} else {
+			format = f
+		}
+	default:
+		r.multiErr.append(phaseDecode, fmt.Errorf("found unknown response format %s", responseFormat))
+	}
+
+	switch format {
+	case targetFormatJSON:
+		if r.unwrap != "" {
+			if err := decodeEnvelope(text, r.unwrap, target); err != nil {
+				r.multiErr.append(phaseDecode, err)
+			}
+			break
+		}
+		if err := json.NewDecoder(text).Decode(target); err != nil {
+			r.multiErr.append(phaseDecode, err)
+		}
+	case targetFormatXML:
+		decoder := xml.NewDecoder(text)
+		decoder.CharsetReader = xmlCharsetReader
+		if err := decoder.Decode(target); err != nil {
+			r.multiErr.append(phaseDecode, err)
+		}
+	case targetFormatBytes:
+		v := reflect.ValueOf(target)
+		if k := v.Kind(); k != reflect.Ptr {
+			r.multiErr.append(phaseDecode, fmt.Errorf("expected pointer kind, encountered %v when decoding into target element", k))
+			break
+		}
+		if s := v.Elem().Type().String(); s != "[]uint8" {
+			r.multiErr.append(phaseDecode, fmt.Errorf("expected byte slice elem, encountered %s when decoding into target element", s))
+			break
+		}
+		v.Elem().Set(reflect.ValueOf(append([]byte(nil), b...)))
+	default:
+		if f, ok := lookupFormat(string(format)); ok {
+			if err := f.decode(text, target); err != nil {
+				r.multiErr.append(phaseDecode, err)
+			}
+		}
+	}
+}
+
+// textReader returns a reader for the given body. Text based formats are
+// decoded into UTF-8 in case the body uses a supported charset, unknown
+// charsets are passed through unchanged. It reports whether the charset
+// has been decoded.
+func (r *request) textReader(body []byte, charset string) (io.Reader, bool) {
+	var text io.Reader = bytes.NewReader(body)
+	decoded := false
+	if charset != "" {
+		if reader, err := charsetReader(charset, text); err == nil {
+			text = reader
+			decoded = true
+		}
+	}
+	if r.decodeBufferSize > 0 {
+		text = bufio.NewReaderSize(text, r.decodeBufferSize)
+	}
+	return text, decoded
+}
+
+// readBody reads the response body, verifying its digest and running all
+// validators against it if configured. The request's timeout and context
+// bound the whole process, so neither a slow body nor a slow validator can
+// exceed them. Validators that are still running when the deadline passes
+// are abandoned. The given body received from the transport is closed for
+// unblocking the read, which is awaited, as the readers wrapping it, e.g.
+// for decompressing, cannot be used concurrently.
+func (r *request) readBody(timeout requestTimeout, res *http.Response, received io.Closer) ([]byte, error) {
+	type result struct {
+		body []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	read := make(chan struct{})
+	go func() {
+		b, err := ioutil.ReadAll(res.Body)
+		close(read)
+		if err == nil && r.verifyDigest {
+			err = verifyDigest(res.Header, b)
+		}
+		for _, validate := range r.validators {
+			if err != nil {
+				break
+			}
+			if validationErr := validate(b); validationErr != nil {
+				err = fmt.Errorf("response validation failed: %w", validationErr)
+			}
+		}
+		done <- result{b, err}
+	}()
+
+	select {
+	case <-timeout.Done():
+		// unblock reading the body in case it is still in progress
+		received.Close()
+		<-read
+		return nil, timeout.doneErr(r.context)
+	case result := <-done:
+		if result.err != nil && timeout.Err() != nil {
+			// reading the body has been canceled along with the request
+			return nil, timeout.doneErr(r.context)
+		}
+		return result.body, result.err
+	}
+}
+
+// decodeEnvelope decodes the JSON object read from body and decodes the value
+// found under the given key onto target.
+func decodeEnvelope(body io.Reader, key string, target interface{}) error {
+	envelope := map[string]json.RawMessage{}
+	if err := json.NewDecoder(body).Decode(&envelope); err != nil {
+		return err
+	}
+	value, ok := envelope[key]
+	if !ok {
+		return fmt.Errorf("response envelope does not contain key %s", key)
+	}
+	return json.Unmarshal(value, target)
+}
@@ -1,15 +1,25 @@
 package rekwest
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -25,12 +35,50 @@ func (b badTransport) RoundTrip(*http.Request) (*http.Response, error) {
 	return nil, errors.New("i'm just a bad transport")
 }
 
+type contextKey string
+
+// contextTransport responds with the value found in the request's context
+// under the given key.
+type contextTransport contextKey
+
+func (c contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	value, _ := req.Context().Value(contextKey(c)).(string)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader(value)),
+		Request:    req,
+	}, nil
+}
+
+// requireKeys is a minimal stand in for a JSON schema validator that
+// requires the given top level keys to be present.
+func requireKeys(keys ...string) func([]byte) error {
+	return func(body []byte) error {
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &object); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, ok := object[key]; !ok {
+				return fmt.Errorf("missing required key %s", key)
+			}
+		}
+		return nil
+	}
+}
+
 type badReader int
 
 func (b badReader) Read([]byte) (int, error) {
 	return 0, errors.New("i'm just a bad reader")
 }
 
+func bytesPointer(s string) *[]byte {
+	b := []byte(s)
+	return &b
+}
+
 func TestRekwest(t *testing.T) {
 	tests := map[string]struct {
 		handler        http.HandlerFunc
@@ -118,6 +166,271 @@ func TestRekwest(t *testing.T) {
 			[]interface{}{&responseType{}},
 			errors.New("unexpected EOF"),
 		},
+		"accept charset latin-1": {
+			func(w http.ResponseWriter, r *http.Request) {
+				if accept := r.Header.Get("Accept-Charset"); accept != "iso-8859-1, utf-8;q=0.9, us-ascii;q=0.8" {
+					http.Error(w, "unexpected Accept-Charset "+accept, http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json; charset=ISO-8859-1")
+				w.Write([]byte("{\"ok\":true,\"animal\":\"ornitorrinco \xe9\xf1\"}"))
+			},
+			func(r Rekwest) {
+				r.AcceptCharset("iso-8859-1", "utf-8", "us-ascii")
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "ornitorrinco éñ",
+			}},
+			nil,
+		},
+		"accept language": {
+			func(w http.ResponseWriter, r *http.Request) {
+				if accept := r.Header.Get("Accept-Language"); accept != "de-CH, de;q=0.9, en;q=0.8" {
+					http.Error(w, "unexpected Accept-Language "+accept, http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true,"animal":"Schnabeltier"}`))
+			},
+			func(r Rekwest) {
+				r.AcceptLanguage("de-CH", "de", "en")
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "Schnabeltier",
+			}},
+			nil,
+		},
+		"latin-1 xml payload": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><responseType><ok>true</ok><animal>ornitorrinco \xe9\xf1</animal></responseType>"))
+			},
+			func(r Rekwest) {},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "ornitorrinco éñ",
+			}},
+			nil,
+		},
+		"priority": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(r.Header.Get("Priority")))
+			},
+			func(r Rekwest) {
+				r.Priority(256)
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer("u=0")},
+			nil,
+		},
+		"priority clamped": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(r.Header.Get("Priority")))
+			},
+			func(r Rekwest) {
+				r.Priority(-12)
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer("u=7")},
+			nil,
+		},
+		"zero content length": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Length", "0")
+			},
+			func(r Rekwest) {
+				r.ResponseFormat(ResponseFormatJSON)
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{}},
+			nil,
+		},
+		"max response bytes": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("platypus"))
+			},
+			func(r Rekwest) {
+				r.MaxResponseBytes(8)
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer("platypus")},
+			nil,
+		},
+		"max response bytes exceeded": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+			},
+			func(r Rekwest) {
+				r.MaxResponseBytes(10)
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{}},
+			errors.New("response body exceeded limit of 10 bytes, read 11 bytes before truncating"),
+		},
+		"max response headers": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Add("X-Animal", "platypus")
+				w.Header().Add("X-Animal", "echidna")
+				w.Write([]byte("platypus"))
+			},
+			func(r Rekwest) {
+				r.MaxResponseHeaders(5)
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer("platypus")},
+			nil,
+		},
+		"max response headers exceeded": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Add("X-Animal", "platypus")
+				w.Header().Add("X-Animal", "echidna")
+				w.Write([]byte("platypus"))
+			},
+			func(r Rekwest) {
+				r.MaxResponseHeaders(4)
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{&[]byte{}},
+			errors.New("response has 5 header fields, exceeding limit of 4"),
+		},
+		"verify digest": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-MD5", "/LizokxbxSmyuwjKB4N6CA==")
+				w.Header().Set("Digest", "SHA-256=tm9KLRHWliqQoDDI5PHMDUa/tDDG7OsNQcI6AWV4Z2E=,UNIXsum=30637")
+				w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+			},
+			func(r Rekwest) {
+				r.VerifyDigest()
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "platypus",
+			}},
+			nil,
+		},
+		"verify digest mismatch": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Digest", "SHA-256=tm9KLRHWliqQoDDI5PHMDUa/tDDG7OsNQcI6AWV4Z2E=")
+				w.Write([]byte(`{"ok":true,"animal":"dog"}`))
+			},
+			func(r Rekwest) {
+				r.VerifyDigest()
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{}},
+			errors.New("response body does not match sha-256 digest tm9KLRHWliqQoDDI5PHMDUa/tDDG7OsNQcI6AWV4Z2E="),
+		},
+		"validate": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+			},
+			func(r Rekwest) {
+				r.Validate(requireKeys("ok", "animal"))
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "platypus",
+			}},
+			nil,
+		},
+		"validate violation": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"animal":"platypus"}`))
+			},
+			func(r Rekwest) {
+				r.Validate(requireKeys("animal")).Validate(requireKeys("ok"))
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{}},
+			errors.New("response validation failed: missing required key ok"),
+		},
+		"concatenated gzip members": {
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != "gzip" {
+					http.Error(w, "expected gzip to be accepted", http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", "gzip")
+				for _, member := range []string{`{"ok":true,`, `"animal":`, `"platypus"}`} {
+					gz := gzip.NewWriter(w)
+					gz.Write([]byte(member))
+					gz.Close()
+				}
+			},
+			func(r Rekwest) {
+				// the transport must not decompress the body transparently,
+				// so it is decoded by rekwest
+				r.Client(&http.Client{Transport: &http.Transport{DisableCompression: true}}).
+					Header("Accept-Encoding", "gzip")
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "platypus",
+			}},
+			nil,
+		},
+		"decode buffer size": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+			},
+			func(r Rekwest) {
+				r.DecodeBufferSize(16)
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "platypus",
+			}},
+			nil,
+		},
+		"unwrap envelope": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"data":{"ok":true,"animal":"platypus"},"meta":{}}`))
+			},
+			func(r Rekwest) {
+				r.Unwrap("data")
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "platypus",
+			}},
+			nil,
+		},
+		"unwrap missing key": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"result":{"ok":true,"animal":"platypus"}}`))
+			},
+			func(r Rekwest) {
+				r.Unwrap("data")
+			},
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{}},
+			errors.New("response envelope does not contain key data"),
+		},
 		"bad xml payload": {
 			func(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Content-Type", "application/xml; charset=utf-8")
@@ -209,6 +522,26 @@ func TestRekwest(t *testing.T) {
 			[]interface{}{&[]byte{'n', 'o'}},
 			nil,
 		},
+		"channel body": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				b, _ := ioutil.ReadAll(r.Body)
+				w.Write(b)
+			},
+			func(r Rekwest) {
+				ch := make(chan []byte)
+				go func() {
+					for _, chunk := range []string{"pla", "", "ty", "pus"} {
+						ch <- []byte(chunk)
+					}
+					close(ch)
+				}()
+				r.Method(http.MethodPost).ChannelBody(ch, nil)
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer("platypus")},
+			nil,
+		},
 		"json body": {
 			func(w http.ResponseWriter, r *http.Request) {
 				b, _ := ioutil.ReadAll(r.Body)
@@ -229,6 +562,33 @@ func TestRekwest(t *testing.T) {
 			[]interface{}{&[]byte{'d', 'o', 'g'}},
 			nil,
 		},
+		"tagged json body": {
+			func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write(b)
+			},
+			func(r Rekwest) {
+				type inner struct {
+					Name string `apijson:"name"`
+				}
+				r.JSONBodyTagged(struct {
+					Kind     string `json:"ignored" apijson:"kind"`
+					Flappers int    `apijson:"flappers,omitempty"`
+					Skipped  bool   `apijson:"-"`
+					Owner    *inner `apijson:"owner"`
+					Untagged string
+				}{
+					Kind:     "platypus",
+					Skipped:  true,
+					Owner:    &inner{"frederik"},
+					Untagged: "yes",
+				}, "apijson")
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer(`{"Untagged":"yes","kind":"platypus","owner":{"name":"frederik"}}`)},
+			nil,
+		},
 		"bad json body": {
 			func(w http.ResponseWriter, r *http.Request) {
 				b, _ := ioutil.ReadAll(r.Body)
@@ -317,6 +677,31 @@ func TestRekwest(t *testing.T) {
 			[]interface{}{},
 			errors.New("exceeded request timeout of 1µs"),
 		},
+		"response header timeout": {
+			func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+				w.Write([]byte("ok"))
+			},
+			func(r Rekwest) {
+				r.Timeout(time.Second).ResponseHeaderTimeout(time.Millisecond)
+			},
+			[]interface{}{},
+			[]interface{}{},
+			errors.New("timeout awaiting response headers"),
+		},
+		"response header timeout bad transport": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			},
+			func(r Rekwest) {
+				r.Client(&http.Client{
+					Transport: badTransport(0),
+				}).ResponseHeaderTimeout(time.Second)
+			},
+			[]interface{}{},
+			[]interface{}{},
+			errors.New("cannot apply transport options to transport of type rekwest.badTransport"),
+		},
 		"context ok": {
 			func(w http.ResponseWriter, r *http.Request) {
 				time.Sleep(time.Millisecond)
@@ -442,37 +827,77 @@ func TestRekwest(t *testing.T) {
 			[]interface{}{&[]byte{}},
 			errors.New("i'm just a bad transport"),
 		},
-		"bad target type": {
+		"replay": {
 			func(w http.ResponseWriter, r *http.Request) {
-				w.Header().Set("Content-Type", "text/plain")
-				w.Write([]byte("OK"))
+				http.Error(w, "should not be called", http.StatusInternalServerError)
 			},
 			func(r Rekwest) {
+				r.Replay(http.StatusOK, http.Header{
+					"Content-Type": []string{"application/json"},
+				}, []byte(`{"ok":true,"animal":"platypus"}`))
 			},
-			[]interface{}{&[]string{}},
-			[]interface{}{&[]string{}},
-			errors.New("expected byte slice elem, encountered []string when decoding into target element"),
+			[]interface{}{&responseType{}},
+			[]interface{}{&responseType{
+				OK:     true,
+				Animal: "platypus",
+			}},
+			nil,
 		},
-		"non pointer target": {
+		"replay error status": {
 			func(w http.ResponseWriter, r *http.Request) {
-				w.Header().Set("Content-Type", "text/plain")
-				w.Write([]byte("OK"))
+				w.Write([]byte("ok"))
 			},
 			func(r Rekwest) {
+				r.Replay(http.StatusNotFound, nil, []byte("not found"))
 			},
-			[]interface{}{[]string{}},
-			[]interface{}{[]string{}},
-			errors.New("expected pointer kind, encountered slice when decoding into target element"),
+			[]interface{}{&[]byte{}},
+			[]interface{}{&[]byte{}},
+			errors.New("request failed with status 404: not found"),
 		},
-		"bad body": {
+		"context value": {
 			func(w http.ResponseWriter, r *http.Request) {
-				w.Write([]byte("OK"))
+				w.Write([]byte("not the transport"))
 			},
 			func(r Rekwest) {
-				r.Body(badReader(0))
+				r.WithValue(contextKey("request-id"), "platypus").Client(&http.Client{
+					Transport: contextTransport("request-id"),
+				})
+			},
+			[]interface{}{&[]byte{}},
+			[]interface{}{bytesPointer("platypus")},
+			nil,
+		},
+		"bad target type": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("OK"))
+			},
+			func(r Rekwest) {
+			},
+			[]interface{}{&[]string{}},
+			[]interface{}{&[]string{}},
+			errors.New("expected byte slice elem, encountered []string when decoding into target element"),
+		},
+		"non pointer target": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("OK"))
+			},
+			func(r Rekwest) {
+			},
+			[]interface{}{[]string{}},
+			[]interface{}{[]string{}},
+			errors.New("expected pointer kind, encountered slice when decoding into target element"),
+		},
+		"bad body": {
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			},
+			func(r Rekwest) {
+				r.Body(badReader(0))
 			},
 			[]interface{}{&[]string{}},
-			[]interface{}{&[]string{}},
+			[]interface{}{&[]string{}},
 			errors.New("i'm just a bad reader"),
 		},
 		"bad content type": {
@@ -512,9 +937,2071 @@ func TestRekwest(t *testing.T) {
 	}
 }
 
+func TestRekwest_StrictBuild(t *testing.T) {
+	unmarshalable := map[string]interface{}{"fn": func() {}}
+
+	r := New("http://www.example.com").JSONBody(unmarshalable)
+	if r.OK() || len(r.Errors()) != 1 {
+		t.Errorf("Expected marshal error to be detectable before Do, got %v", r.Errors())
+	}
+
+	expectPanic := func(t *testing.T, build func()) {
+		defer func() {
+			err, ok := recover().(error)
+			var unsupported *json.UnsupportedTypeError
+			if !ok || !errors.As(err, &unsupported) {
+				t.Errorf("Expected panic with marshal error, got %v", err)
+			}
+		}()
+		build()
+	}
+	t.Run("after", func(t *testing.T) {
+		expectPanic(t, func() {
+			New("http://www.example.com").StrictBuild().JSONBody(unmarshalable)
+		})
+	})
+	t.Run("before", func(t *testing.T) {
+		expectPanic(t, func() {
+			New("http://www.example.com").JSONBody(unmarshalable).StrictBuild()
+		})
+	})
+	t.Run("valid", func(t *testing.T) {
+		if r := New("http://www.example.com").StrictBuild().JSONBody("platypus"); !r.OK() {
+			t.Errorf("Unexpected errors %v", r.Errors())
+		}
+	})
+}
+
 func TestRekwest_BadURL(t *testing.T) {
+	// the wording of parse errors differs between versions of Go
+	_, parseErr := url.Parse("%%%bbbrrrrroookkkken%%251%%``")
+	expected := fmt.Sprintf("error performing the request: %v", parseErr)
+
 	r := New("%%%bbbrrrrroookkkken%%251%%``")
-	if err := r.Do(); err == nil || err.Error() != "error performing the request: parse %%%bbbrrrrroookkkken%%251%%``: invalid URL escape \"%%%\"" {
+	if err := r.Do(); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	r = New("%%%bbbrrrrroookkkken%%251%%``").Query("animal", "platypus")
+	err := r.Do()
+	var multiErr MultiError
+	if err == nil || err.Error() != expected || !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+type apiError struct {
+	Status  int
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.Status, e.Message)
+}
+
+func TestRekwest_ErrorFormatter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(`{"message":"no coffee"}`))
+	}))
+	defer ts.Close()
+
+	formatter := func(status int, body []byte) error {
+		if status != http.StatusTeapot {
+			return nil
+		}
+		err := &apiError{Status: status}
+		json.Unmarshal(body, err)
+		return err
+	}
+
+	t.Run("custom", func(t *testing.T) {
+		err := New(ts.URL).ErrorFormatter(formatter).Do()
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("Expected apiError, got %v", err)
+		}
+		if expected := (apiError{http.StatusTeapot, "no coffee"}); *apiErr != expected {
+			t.Errorf("Expected %v, got %v", expected, *apiErr)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		err := New(ts.URL).ErrorFormatter(func(int, []byte) error { return nil }).Do()
+		if expected := `request failed with status 418: {"message":"no coffee"}`; err == nil || err.Error() != expected {
+			t.Errorf("Expected %q, got %v", expected, err)
+		}
+	})
+}
+
+func TestRekwest_StatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).Do()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected StatusError, got %v", err)
+	}
+	if statusErr.Code != http.StatusMethodNotAllowed || string(statusErr.Body) != "method not allowed\n" {
+		t.Errorf("Unexpected status error with code %d and body %q", statusErr.Code, statusErr.Body)
+	}
+	if expected := "request failed with status 405: method not allowed\n"; err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+
+	readErr := errors.New("connection reset")
+	wrapped := &StatusError{Code: http.StatusBadGateway, readErr: readErr}
+	if !errors.Is(wrapped, readErr) {
+		t.Errorf("Expected read error to be unwrapped from %v", wrapped)
+	}
+}
+
+func TestRekwest_PreRequest(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	errMissingTenant := errors.New("missing tenant")
+	var calls []string
+	requireTenant := func(req *http.Request) error {
+		calls = append(calls, "tenant")
+		if req.Header.Get("X-Tenant") == "" {
+			return errMissingTenant
+		}
+		return nil
+	}
+	record := func(req *http.Request) error {
+		calls = append(calls, "record")
+		return nil
+	}
+
+	err := New(ts.URL).PreRequest(requireTenant).PreRequest(record).Do()
+	if !errors.Is(err, errMissingTenant) {
+		t.Errorf("Expected hook error, got %v", err)
+	}
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+		t.Errorf("Expected hook error to be a build error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected request to be aborted, got %d requests", requests)
+	}
+	if !reflect.DeepEqual([]string{"tenant"}, calls) {
+		t.Errorf("Expected hooks to stop at the first error, got %v", calls)
+	}
+
+	calls = nil
+	if err := New(ts.URL).Header("X-Tenant", "zoo").PreRequest(requireTenant).PreRequest(record).Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if requests != 1 || !reflect.DeepEqual([]string{"tenant", "record"}, calls) {
+		t.Errorf("Expected all hooks to run before sending, got %d requests and calls %v", requests, calls)
+	}
+}
+
+func TestRekwest_Cookie(t *testing.T) {
+	var received []string
+	var cookies []*http.Cookie
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header["Cookie"]
+		cookies = r.Cookies()
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).
+		Cookie(&http.Cookie{Name: "session", Value: "abc123", Path: "/ignored"}).
+		Cookies(&http.Cookie{Name: "animal", Value: "duck-billed platypus"}, &http.Cookie{Name: "kind", Value: `"mammal";`}).
+		Do()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{`session=abc123; animal="duck-billed platypus"; kind=mammal`}; !reflect.DeepEqual(expected, received) {
+		t.Errorf("Expected Cookie header %v, got %v", expected, received)
+	}
+	if len(cookies) != 3 || cookies[0].Value != "abc123" || cookies[1].Value != "duck-billed platypus" {
+		t.Errorf("Unexpected cookies %v", cookies)
+	}
+}
+
+func TestRekwest_UserAgent(t *testing.T) {
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header["User-Agent"]
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		request  Rekwest
+		expected []string
+	}{
+		{"default", New(ts.URL), []string{"Go-http-client/1.1"}},
+		{"custom", New(ts.URL).UserAgent("animal-importer/1.2"), []string{"animal-importer/1.2"}},
+		{"replaced", New(ts.URL).Header("User-Agent", "other").UserAgent("animal-importer/1.2"), []string{"animal-importer/1.2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.request.Do(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(test.expected, received) {
+				t.Errorf("Expected User-Agent %v, got %v", test.expected, received)
+			}
+		})
+	}
+}
+
+func TestRekwest_AcceptStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"ok":false,"animal":"unicorn"}`))
+	}))
+	defer ts.Close()
+
+	t.Run("accepted", func(t *testing.T) {
+		data := responseType{}
+		r := New(ts.URL).AcceptStatus(http.StatusGone, http.StatusNotFound)
+		if err := r.Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if data.Animal != "unicorn" {
+			t.Errorf("Expected body to be decoded, got %v", data)
+		}
+		if r.StatusCode() != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", r.StatusCode())
+		}
+	})
+	t.Run("default", func(t *testing.T) {
+		data := responseType{}
+		err := New(ts.URL).AcceptStatus(http.StatusGone).Do(&data)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+			t.Errorf("Expected status error, got %v", err)
+		}
+		if data.Animal != "" {
+			t.Errorf("Expected body not to be decoded, got %v", data)
+		}
+	})
+}
+
+func TestRekwest_BodyContentType(t *testing.T) {
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header["Content-Type"]
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		request  Rekwest
+		expected []string
+	}{
+		{"json", New(ts.URL).JSONBody(responseType{}), []string{"application/json"}},
+		{"xml", New(ts.URL).XMLBody(responseType{}), []string{"application/xml"}},
+		{"form", New(ts.URL).FormBody(url.Values{"animal": {"platypus"}}), []string{"application/x-www-form-urlencoded"}},
+		{
+			"explicit before",
+			New(ts.URL).Header("Content-Type", "application/vnd.animal+json").JSONBody(responseType{}),
+			[]string{"application/vnd.animal+json"},
+		},
+		{
+			"explicit after",
+			New(ts.URL).XMLBody(responseType{}).Header("Content-Type", "application/vnd.animal+xml"),
+			[]string{"application/vnd.animal+xml"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.request.Method(http.MethodPost).Do(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(test.expected, received) {
+				t.Errorf("Expected Content-Type %v, got %v", test.expected, received)
+			}
+		})
+	}
+}
+
+func TestRekwest_ExtensionMethod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" {
+			http.Error(w, "unexpected method "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL).Method("PROPFIND")
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if r.StatusCode() != http.StatusMultiStatus {
+		t.Errorf("Expected status 207, got %d", r.StatusCode())
+	}
+
+	for _, method := range []string{"", "GET /", "PROP FIND", "GÉT"} {
+		if r := New(ts.URL).Method(method); r.OK() {
+			t.Errorf("Expected method %q to be rejected", method)
+		}
+	}
+}
+
+func TestRekwest_ContentLength(t *testing.T) {
+	var length int64
+	var encoding []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		length = r.ContentLength
+		encoding = r.TransferEncoding
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		request  Rekwest
+		expected int64
+	}{
+		// json.Encoder terminates the value with a newline
+		{"json", New(ts.URL).JSONBody(responseType{OK: true, Animal: "platypus"}), 31},
+		{"xml", New(ts.URL).XMLBody(responseType{OK: true, Animal: "platypus"}), 67},
+		{"bytes", New(ts.URL).BytesBody([]byte("platypus")), 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.request.Method(http.MethodPost).Do(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if length != test.expected {
+				t.Errorf("Expected Content-Length %d, got %d", test.expected, length)
+			}
+			if len(encoding) != 0 {
+				t.Errorf("Expected body not to be chunked, got %v", encoding)
+			}
+		})
+	}
+}
+
+func TestRekwest_ResetBody(t *testing.T) {
+	var contentType string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL).Method(http.MethodPost).JSONBody(responseType{Animal: "platypus"})
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if contentType != "application/json" || !strings.Contains(string(body), "platypus") {
+		t.Errorf("Unexpected request with Content-Type %q and body %q", contentType, body)
+	}
+
+	if err := r.ResetBody().Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if contentType != "" || len(body) != 0 {
+		t.Errorf("Expected body to be cleared, got Content-Type %q and body %q", contentType, body)
+	}
+
+	if err := r.ResetBody().BytesBody([]byte("echidna")).Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if contentType != "" || string(body) != "echidna" {
+		t.Errorf("Expected new body, got Content-Type %q and body %q", contentType, body)
+	}
+}
+
+func TestRekwest_MultiValueHeaders(t *testing.T) {
+	var received http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).
+		Header("X-Forwarded-For", "10.0.0.1").
+		Header("X-Forwarded-For", "10.0.0.2").
+		Headers(map[string]string{"X-Animal": "platypus"}).
+		Do()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{"10.0.0.1", "10.0.0.2"}; !reflect.DeepEqual(expected, received["X-Forwarded-For"]) {
+		t.Errorf("Expected X-Forwarded-For %v, got %v", expected, received["X-Forwarded-For"])
+	}
+	if expected := []string{"platypus"}; !reflect.DeepEqual(expected, received["X-Animal"]) {
+		t.Errorf("Expected X-Animal %v, got %v", expected, received["X-Animal"])
+	}
+}
+
+func TestRekwest_SetHeaders(t *testing.T) {
+	var received http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).
+		Header("X-Animal", "platypus").
+		SetHeaders(http.Header{
+			"X-Forwarded-For": {"10.0.0.1", "10.0.0.2"},
+			"X-Animal":        {"duck"},
+		}).
+		Do()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{"10.0.0.1", "10.0.0.2"}; !reflect.DeepEqual(expected, received["X-Forwarded-For"]) {
+		t.Errorf("Expected X-Forwarded-For %v, got %v", expected, received["X-Forwarded-For"])
+	}
+	if expected := []string{"platypus", "duck"}; !reflect.DeepEqual(expected, received["X-Animal"]) {
+		t.Errorf("Expected X-Animal %v, got %v", expected, received["X-Animal"])
+	}
+}
+
+func TestRekwest_FormBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"contentType": r.Header.Get("Content-Type"),
+			"form":        r.PostForm,
+		})
+	}))
+	defer ts.Close()
+
+	data := struct {
+		ContentType string              `json:"contentType"`
+		Form        map[string][]string `json:"form"`
+	}{}
+	err := New(ts.URL).
+		Method(http.MethodPost).
+		FormBody(url.Values{"animal": {"platypus"}, "tag": {"mammal", "oviparous & venomous"}}).
+		Do(&data)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if data.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Unexpected content type %v", data.ContentType)
+	}
+	if expected := map[string][]string{"animal": {"platypus"}, "tag": {"mammal", "oviparous & venomous"}}; !reflect.DeepEqual(expected, data.Form) {
+		t.Errorf("Expected form %v, got %v", expected, data.Form)
+	}
+}
+
+func TestRekwest_DefaultScheme(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Write([]byte("https"))
+			return
+		}
+		w.Write([]byte("http"))
+	})
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+
+	tests := []struct {
+		name     string
+		request  Rekwest
+		expected string
+	}{
+		{
+			"default",
+			New(strings.TrimPrefix(tlsServer.URL, "https:")).Client(tlsServer.Client()),
+			"https",
+		},
+		{
+			"custom",
+			New(strings.TrimPrefix(plainServer.URL, "http:")).DefaultScheme("http"),
+			"http",
+		},
+		{
+			"absolute",
+			New(plainServer.URL).DefaultScheme("https"),
+			"http",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			if err := test.request.Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("Expected scheme %v, got %v", test.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestRekwest_Query(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		request  Rekwest
+		expected string
+	}{
+		{"none", New(ts.URL + "/animals"), ""},
+		{"single", New(ts.URL+"/animals").Query("kind", "platypus"), "kind=platypus"},
+		{"escaped", New(ts.URL+"/animals").Query("kind & name", "duck-billed platypus?"), "kind+%26+name=duck-billed+platypus%3F"},
+		{"repeated", New(ts.URL+"/animals").Query("tag", "a").Query("tag", "b"), "tag=a&tag=b"},
+		{"merged", New(ts.URL+"/animals?page=2&tag=a").Query("tag", "b"), "page=2&tag=a&tag=b"},
+		{"values", New(ts.URL+"/animals").QueryValues("tag", []string{"a", "b", "c"}), "tag=a&tag=b&tag=c"},
+		{"empty values", New(ts.URL+"/animals?page=2").QueryValues("tag", nil), "page=2"},
+		{"merged values", New(ts.URL+"/animals?tag=a").Query("kind", "platypus").QueryValues("tag", []string{"b"}), "kind=platypus&tag=a&tag=b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			if err := test.request.ResponseFormat(ResponseFormatBytes).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("Expected query %q, got %q", test.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestRekwest_DefaultQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer ts.Close()
+
+	DefaultQuery.Set("api-version", "2")
+	defer DefaultQuery.Del("api-version")
+
+	tests := []struct {
+		name     string
+		request  Rekwest
+		expected string
+	}{
+		{"default", New(ts.URL + "/animals"), "api-version=2"},
+		{"merged", New(ts.URL+"/animals").Query("kind", "platypus"), "api-version=2&kind=platypus"},
+		{"overridden", New(ts.URL+"/animals").Query("api-version", "3"), "api-version=3"},
+		{"overridden in url", New(ts.URL + "/animals?api-version=1"), "api-version=1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			if err := test.request.ResponseFormat(ResponseFormatBytes).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("Expected query %q, got %q", test.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestRekwest_PollUntil(t *testing.T) {
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/jobs":
+			if r.Method != http.MethodPost || r.Header.Get("Prefer") != "respond-async" {
+				http.Error(w, "expected async POST", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Location", "/jobs/1")
+			w.WriteHeader(http.StatusAccepted)
+		case "/jobs/1":
+			polls++
+			if polls < 2 {
+				w.Header().Set("Location", "/jobs/1")
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	data := responseType{}
+	err := New(ts.URL+"/jobs").
+		Method(http.MethodPost).
+		Prefer("respond-async").
+		Timeout(time.Second).
+		PollUntil(&data, time.Millisecond, nil)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if polls != 2 {
+		t.Errorf("Expected 2 polls, got %d", polls)
+	}
+	if expected := (responseType{OK: true, Animal: "platypus"}); data != expected {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+}
+
+func TestRekwest_PollUntilRequest(t *testing.T) {
+	var polled *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", "/jobs/1?tenant=a")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		polled = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	data := responseType{}
+	err := New(ts.URL+"/jobs").
+		Method(http.MethodPost).
+		Query("tenant", "a").
+		Header("X-Animal", "platypus").
+		JSONBody(responseType{Animal: "platypus"}).
+		Timeout(time.Second).
+		PollUntil(&data, time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if polled == nil {
+		t.Fatal("Expected location to be polled")
+	}
+	if polled.Method != http.MethodGet || polled.RequestURI != "/jobs/1?tenant=a" {
+		t.Errorf("Expected GET /jobs/1?tenant=a, got %s %s", polled.Method, polled.RequestURI)
+	}
+	if contentType := polled.Header.Get("Content-Type"); contentType != "" {
+		t.Errorf("Expected no Content-Type for polling, got %q", contentType)
+	}
+	if animal := polled.Header.Get("X-Animal"); animal != "platypus" {
+		t.Errorf("Expected headers to be sent when polling, got %q", animal)
+	}
+}
+
+func TestRekwest_PollUntilTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/jobs/1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).Timeout(50*time.Millisecond).PollUntil(nil, time.Millisecond, nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeded request timeout of 50ms") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRekwest_EffectiveDeadline(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		if _, ok := New("http://www.example.com").EffectiveDeadline(); ok {
+			t.Error("Expected no deadline")
+		}
+	})
+
+	t.Run("context wins", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		expected, _ := ctx.Deadline()
+		deadline, ok := New("http://www.example.com").Timeout(10 * time.Second).Context(ctx).EffectiveDeadline()
+		if !ok || !deadline.Equal(expected) {
+			t.Errorf("Expected deadline %v, got %v", expected, deadline)
+		}
+	})
+
+	t.Run("timeout wins", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		start := time.Now()
+		deadline, ok := New("http://www.example.com").Timeout(2 * time.Second).Context(ctx).EffectiveDeadline()
+		if remaining := deadline.Sub(start); !ok || remaining < 2*time.Second || remaining > 3*time.Second {
+			t.Errorf("Expected deadline in 2s, got %v", remaining)
+		}
+	})
+
+	t.Run("applied", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}))
+		defer ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := New(ts.URL).Timeout(10 * time.Second).Context(ctx).Do()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context deadline to apply, got %v", err)
+		}
+	})
+}
+
+func TestRekwest_ValidateTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	err := New(ts.URL).
+		Timeout(50 * time.Millisecond).
+		Validate(func([]byte) error {
+			time.Sleep(time.Second)
+			return nil
+		}).
+		Do(&responseType{})
+	if err == nil || !strings.Contains(err.Error(), "exceeded request timeout of 50ms") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected validation to be abandoned, took %v", elapsed)
+	}
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) || len(multiErr.DecodeErrors()) != 1 {
+		t.Errorf("Expected a single decode error, got %v", err)
+	}
+}
+
+func TestRekwest_ErrorPhases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"animal": "platypus", "ok}`))
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL)
+	if err := r.Do(&responseType{}); err == nil {
+		t.Fatal("Expected decode error, got nil")
+	}
+	r.JSONBody(func() string { return "oh hey" })
+
+	err := r.Do(&responseType{})
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("Expected MultiError, got %v", err)
+	}
+	if build := multiErr.BuildErrors(); len(build) != 1 || build[0].Error() != "json: unsupported type: func() string" {
+		t.Errorf("Unexpected build errors %v", build)
+	}
+	if decode := multiErr.DecodeErrors(); len(decode) != 1 || decode[0].Error() != "unexpected EOF" {
+		t.Errorf("Unexpected decode errors %v", decode)
+	}
+	if transport := multiErr.TransportErrors(); len(transport) != 0 {
+		t.Errorf("Unexpected transport errors %v", transport)
+	}
+	if expected := "could not perform request: unexpected EOF, json: unsupported type: func() string"; err.Error() != expected {
+		t.Errorf("Expected %v, got %v", expected, err)
+	}
+}
+
+func TestRekwest_TransportErrorPhase(t *testing.T) {
+	err := New("http://www.example.com").Client(&http.Client{
+		Transport: badTransport(0),
+	}).Do()
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("Expected MultiError, got %v", err)
+	}
+	if transport := multiErr.TransportErrors(); len(transport) != 1 {
+		t.Errorf("Unexpected transport errors %v", transport)
+	}
+}
+
+func TestRekwest_TimeoutFraction(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	r := New(ts.URL).Context(ctx).TimeoutFraction(0.1)
+	effective := r.(*request).effectiveTimeout(time.Now())
+	if effective == nil || *effective > 100*time.Millisecond || *effective < 90*time.Millisecond {
+		t.Errorf("Expected effective timeout of about 100ms, got %v", effective)
+	}
+
+	err := r.Do()
+	if err == nil || !strings.Contains(err.Error(), "exceeded request timeout of") {
 		t.Errorf("Unexpected error %v", err)
 	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected request timeout to fire before context deadline, got %v", err)
+	}
+}
+
+func TestRekwest_TimeoutLeak(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		if err := New(ts.URL).Client(client).Timeout(10 * time.Millisecond).Do(); err == nil {
+			t.Fatal("Expected timeout error, got nil")
+		}
+	}
+
+	// canceled requests are torn down asynchronously
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before+5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("Expected goroutines to be released after timing out, got %d before and %d after", before, after)
+	}
+}
+
+type deadlineTransport struct {
+	deadline *time.Time
+}
+
+func (d deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	*d.deadline, _ = req.Context().Deadline()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRekwest_TimeoutCancelsRequest(t *testing.T) {
+	canceled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":`))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer ts.Close()
+
+	var deadline time.Time
+	start := time.Now()
+	err := New(ts.URL).
+		Client(&http.Client{Transport: deadlineTransport{&deadline}}).
+		Timeout(100 * time.Millisecond).
+		Do(&responseType{})
+	if err == nil || !strings.Contains(err.Error(), "exceeded request timeout of 100ms") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if deadline.IsZero() || deadline.Sub(start) > 150*time.Millisecond {
+		t.Errorf("Expected request context to carry the timeout, got deadline %v", deadline)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("Expected in-flight request to be canceled")
+	}
+}
+
+func TestRekwest_DecodeTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,`))
+		w.(http.Flusher).Flush()
+		if r.URL.Query().Get("slow") != "" {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte(`"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	t.Run("slow headers", func(t *testing.T) {
+		data := responseType{}
+		if err := New(ts.URL).Timeout(5 * time.Second).DecodeTimeout(100 * time.Millisecond).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if data.Animal != "platypus" {
+			t.Errorf("Unexpected response %v", data)
+		}
+	})
+	t.Run("slow body", func(t *testing.T) {
+		start := time.Now()
+		err := New(ts.URL + "?slow=1").Timeout(5 * time.Second).DecodeTimeout(100 * time.Millisecond).Do(&responseType{})
+		if err == nil || !strings.Contains(err.Error(), "exceeded decode timeout of 100ms") {
+			t.Errorf("Expected decode timeout error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 600*time.Millisecond {
+			t.Errorf("Expected decode timeout to fire independently, took %v", elapsed)
+		}
+	})
+	t.Run("slow compressed body", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		compressed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(`{"ok":true,`))
+			gz.Flush()
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+		defer compressed.Close()
+
+		// the body is decompressed by rekwest instead of the transport
+		client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+		err := New(compressed.URL).Client(client).Header("Accept-Encoding", "gzip").DecodeTimeout(100 * time.Millisecond).Do(&responseType{})
+		if err == nil || !strings.Contains(err.Error(), "exceeded decode timeout of 100ms") {
+			t.Errorf("Expected decode timeout error, got %v", err)
+		}
+	})
+}
+
+func TestRekwest_TimeoutAndContextDone(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := New("http://www.example.com").Context(ctx).Timeout(time.Millisecond).(*request)
+		timeout, stop := r.timeoutContext()
+		<-timeout.Done()
+		cancel()
+		if err := timeout.doneErr(r.context); err == nil || !strings.Contains(err.Error(), "exceeded request timeout of 1ms") {
+			t.Fatalf("Expected timeout error as it fired first, got %v", err)
+		}
+		stop()
+
+		ctx, cancel = context.WithCancel(context.Background())
+		r = New("http://www.example.com").Context(ctx).Timeout(time.Millisecond).(*request)
+		timeout, stop = r.timeoutContext()
+		cancel()
+		time.Sleep(time.Millisecond)
+		if err := timeout.doneErr(r.context); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context error as it fired first, got %v", err)
+		}
+		stop()
+	}
+}
+
+func TestRekwest_TimeoutFractionClamp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	now := time.Now()
+
+	r := New("http://www.example.com").Context(ctx).Timeout(time.Hour).TimeoutFraction(12)
+	if effective := r.(*request).effectiveTimeout(now); effective == nil || *effective > time.Second {
+		t.Errorf("Expected effective timeout of at most 1s, got %v", effective)
+	}
+
+	r.TimeoutFraction(-1)
+	if effective := r.(*request).effectiveTimeout(now); effective == nil || *effective != time.Hour {
+		t.Errorf("Expected effective timeout of 1h, got %v", effective)
+	}
+}
+
+func TestRekwest_DNSErrorPhase(t *testing.T) {
+	err := New("http://rekwest.invalid").Timeout(5 * time.Second).Do()
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("Expected MultiError, got %v", err)
+	}
+	if dns := multiErr.DNSErrors(); len(dns) != 1 {
+		t.Errorf("Expected DNS error, got %v", multiErr)
+	}
+
+	err = New("http://www.example.com").Client(&http.Client{
+		Transport: badTransport(0),
+	}).Do()
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("Expected MultiError, got %v", err)
+	}
+	if dns := multiErr.DNSErrors(); len(dns) != 0 {
+		t.Errorf("Unexpected DNS errors %v", dns)
+	}
+}
+
+var benchmarkPayload = map[string]interface{}{
+	"kind":     "platypus",
+	"flappers": true,
+	"tags":     []string{"mammal", "monotreme", "venomous", "semiaquatic"},
+	"text":     strings.Repeat("duck-billed ", 64),
+}
+
+func BenchmarkRekwest_JSONBody(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New("http://www.example.com").
+			Replay(http.StatusNoContent, nil, nil).
+			JSONBody(benchmarkPayload).
+			Do()
+	}
+}
+
+func BenchmarkRekwest_MarshalBody(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New("http://www.example.com").
+			Replay(http.StatusNoContent, nil, nil).
+			MarshalBody(benchmarkPayload, json.Marshal).
+			Do()
+	}
+}
+
+func TestRekwest_ChannelBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	t.Run("closed error channel", func(t *testing.T) {
+		ch, errs := make(chan []byte), make(chan error)
+		close(errs)
+		go func() {
+			ch <- []byte("platypus")
+			close(ch)
+		}()
+		var data []byte
+		if err := New(ts.URL).Method(http.MethodPost).ChannelBody(ch, errs).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(data) != "platypus" {
+			t.Errorf("Unexpected response %q", data)
+		}
+	})
+
+	t.Run("producer error", func(t *testing.T) {
+		producerErr := errors.New("out of platypuses")
+		ch, errs := make(chan []byte), make(chan error, 1)
+		go func() {
+			defer close(ch)
+			ch <- []byte("platy")
+			errs <- producerErr
+		}()
+		err := New(ts.URL).Method(http.MethodPost).ChannelBody(ch, errs).Do()
+		if !errors.Is(err, producerErr) {
+			t.Fatalf("Expected producer error, got %v", err)
+		}
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 || len(multiErr.TransportErrors()) != 0 {
+			t.Errorf("Expected producer error to be reported as build error, got %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ch := make(chan []byte)
+		go func() {
+			ch <- []byte("platy")
+		}()
+		err := New(ts.URL).Method(http.MethodPost).ChannelBody(ch, nil).Timeout(100 * time.Millisecond).Do()
+		if err == nil || !strings.Contains(err.Error(), "exceeded request timeout") {
+			t.Fatalf("Expected timeout error, got %v", err)
+		}
+		select {
+		case ch <- []byte("pus"):
+			t.Error("Expected reading the channel to stop after the timeout")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestRekwest_PooledBodyReuse(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL).Method(http.MethodPost).JSONBody(responseType{Animal: "platypus"})
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err := r.Do()
+	var multiErr MultiError
+	if !errors.Is(err, errBodyReleased) || !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+		t.Errorf("Expected build error for released body, got %v", err)
+	}
+	if len(bodies) != 1 {
+		t.Errorf("Expected released body not to be sent, got %q", bodies)
+	}
+
+	bodies = nil
+	r = New(ts.URL).Method(http.MethodPost).JSONBody(responseType{Animal: "platypus"})
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := r.BytesBody([]byte("echidna")).Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{`{"ok":false,"animal":"platypus"}`, "echidna", "echidna"}; !reflect.DeepEqual(expected, bodies) {
+		t.Errorf("Expected bodies %q, got %q", expected, bodies)
+	}
+}
+
+func TestRekwest_MarshalBody(t *testing.T) {
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	payload := responseType{OK: true, Animal: "<platypus>"}
+	tests := []struct {
+		name    string
+		marshal func(interface{}) ([]byte, error)
+	}{
+		{"json", json.Marshal},
+		{"xml", xml.Marshal},
+		{"custom", func(data interface{}) ([]byte, error) {
+			return json.MarshalIndent(data, "", "  ")
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, _ := test.marshal(payload)
+			r := New(ts.URL).Method(http.MethodPost).MarshalBody(payload, test.marshal)
+			for i := 0; i < 2; i++ {
+				body = nil
+				if err := r.Do(); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if string(body) != string(expected) {
+					t.Errorf("Expected body %s, got %s", expected, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRekwest_Trace(t *testing.T) {
+	var items []string
+	for i := 0; i < 10000; i++ {
+		items = append(items, fmt.Sprintf(`{"ok":true,"animal":"platypus %d"}`, i))
+	}
+	payload := "[" + strings.Join(items, ",") + "]"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	timing := Timing{Decode: -1}
+	var data []responseType
+	if err := New(ts.URL).Method(http.MethodPost).JSONBody(responseType{Animal: "dog"}).Trace(&timing).Do(&data); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(data) != 10000 {
+		t.Errorf("Expected 10000 items, got %d", len(data))
+	}
+	if timing.Decode <= 0 {
+		t.Errorf("Expected positive decode duration, got %v", timing.Decode)
+	}
+	if timing.Marshal < 0 || timing.Headers < 0 {
+		t.Errorf("Unexpected negative durations in %v", timing)
+	}
+}
+
+func TestRekwest_RedirectBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/final" {
+			b, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(r.Method + " " + string(b)))
+			return
+		}
+		var code int
+		fmt.Sscanf(r.URL.Path, "/redirect/%d", &code)
+		http.Redirect(w, r, "/final", code)
+	}))
+	defer ts.Close()
+
+	tests := map[int]string{
+		http.StatusMovedPermanently:  "GET ",
+		http.StatusFound:             "GET ",
+		http.StatusSeeOther:          "GET ",
+		http.StatusTemporaryRedirect: "POST platypus",
+		http.StatusPermanentRedirect: "POST platypus",
+	}
+	for code, expected := range tests {
+		t.Run(fmt.Sprintf("%d", code), func(t *testing.T) {
+			var result []byte
+			err := New(fmt.Sprintf("%s/redirect/%d", ts.URL, code)).
+				Method(http.MethodPost).
+				BytesBody([]byte("platypus")).
+				Do(&result)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(result) != expected {
+				t.Errorf("Expected %s, got %s", expected, string(result))
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var result []byte
+		err := New(fmt.Sprintf("%s/redirect/%d", ts.URL, http.StatusTemporaryRedirect)).
+			Method(http.MethodPost).
+			JSONBody(responseType{Animal: "dog"}).
+			ResponseFormat(ResponseFormatBytes).
+			Do(&result)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := `POST {"ok":false,"animal":"dog"}`; string(result) != expected {
+			t.Errorf("Expected %s, got %s", expected, string(result))
+		}
+	})
+}
+
+func TestRekwest_DebugOnError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "zalgo", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	t.Run("success", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := New(ts.URL).DebugOnError(&out).Do(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("Expected no output, got %s", out.String())
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		var out bytes.Buffer
+		err := New(ts.URL+"/fail").
+			Method(http.MethodPost).
+			BearerToken("secret").
+			Header("X-Animal", "platypus").
+			BytesBody([]byte("it's me")).
+			DebugOnError(&out).
+			Do()
+		if err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+		output := out.String()
+		expected := []string{
+			"rekwest: request failed with status 500: zalgo",
+			fmt.Sprintf(`curl -X POST '%s/fail' -H 'Authorization: [REDACTED]' -H 'X-Animal: platypus' --data-binary 'it'\''s me'`, ts.URL),
+			"marshal=",
+		}
+		for _, e := range expected {
+			if !strings.Contains(output, e) {
+				t.Errorf("Expected output to contain %s, got %s", e, output)
+			}
+		}
+		if strings.Contains(output, "secret") {
+			t.Errorf("Expected credentials to be redacted, got %s", output)
+		}
+	})
+
+	t.Run("credentials in URL", func(t *testing.T) {
+		var out bytes.Buffer
+		err := New(strings.Replace(ts.URL, "http://", "http://platypus:secret@", 1) + "/fail").
+			DebugOnError(&out).
+			Do()
+		if err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+		output := out.String()
+		if expected := fmt.Sprintf(`curl -X GET '%s/fail'`, ts.URL); !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %s, got %s", expected, output)
+		}
+		if strings.Contains(output, "secret") {
+			t.Errorf("Expected credentials to be redacted, got %s", output)
+		}
+	})
+}
+
+func TestRekwest_ContextDeadlineBudget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := New(ts.URL).Context(ctx).Do()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if err == nil || !regexp.MustCompile(`context deadline exceeded after ~(4\d|50)ms$`).MatchString(err.Error()) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+type stubBreaker struct {
+	open                bool
+	successes, failures int
+}
+
+func (s *stubBreaker) Allow() bool {
+	return !s.open
+}
+
+func (s *stubBreaker) RecordSuccess() {
+	s.successes++
+}
+
+func (s *stubBreaker) RecordFailure() {
+	s.failures++
+}
+
+func TestRekwest_CircuitBreaker(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/fail" {
+			http.Error(w, "zalgo", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	t.Run("open", func(t *testing.T) {
+		requests = 0
+		breaker := &stubBreaker{open: true}
+		err := New(ts.URL).CircuitBreaker(breaker).Do()
+		if err != ErrCircuitOpen {
+			t.Errorf("Expected ErrCircuitOpen, got %v", err)
+		}
+		if requests != 0 {
+			t.Errorf("Expected no requests, got %d", requests)
+		}
+		if breaker.successes != 0 || breaker.failures != 0 {
+			t.Errorf("Unexpected outcomes recorded %v", breaker)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		requests = 0
+		breaker := &stubBreaker{}
+		if err := New(ts.URL).CircuitBreaker(breaker).Do(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if err := New(ts.URL + "/fail").CircuitBreaker(breaker).Do(); err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if requests != 2 {
+			t.Errorf("Expected 2 requests, got %d", requests)
+		}
+		if breaker.successes != 1 || breaker.failures != 1 {
+			t.Errorf("Unexpected outcomes recorded %v", breaker)
+		}
+	})
+}
+
+func TestMustDo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "zalgo", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	t.Run("success", func(t *testing.T) {
+		var data []byte
+		MustDo(New(ts.URL), &data)
+		if string(data) != "ok" {
+			t.Errorf("Expected ok, got %s", string(data))
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		defer func() {
+			err, ok := recover().(error)
+			if !ok || !strings.Contains(err.Error(), "request failed with status 500: zalgo") {
+				t.Errorf("Unexpected panic value %v", err)
+			}
+		}()
+		MustDo(New(ts.URL + "/fail"))
+		t.Error("Expected MustDo to panic")
+	})
+}
+
+func TestRekwest_URLExtension(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	t.Run("json", func(t *testing.T) {
+		data := responseType{}
+		if err := New(ts.URL + "/files/animal.json").Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := (responseType{OK: true, Animal: "platypus"}); data != expected {
+			t.Errorf("Expected %v, got %v", expected, data)
+		}
+	})
+
+	t.Run("no extension", func(t *testing.T) {
+		var data []byte
+		if err := New(ts.URL + "/files/animal").Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := `{"ok":true,"animal":"platypus"}`; string(data) != expected {
+			t.Errorf("Expected %v, got %v", expected, string(data))
+		}
+	})
+}
+
+func TestRekwest_SniffContentType(t *testing.T) {
+	payloads := map[string]string{
+		"/json": `  {"ok":true,"animal":"platypus"}`,
+		"/xml":  `<?xml version="1.0"?><responseType><ok>true</ok><animal>platypus</animal></responseType>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// prevent net/http from detecting the content type itself
+		w.Header()["Content-Type"] = nil
+		w.Write([]byte(payloads[r.URL.Path]))
+	}))
+	defer ts.Close()
+
+	for path := range payloads {
+		t.Run(path, func(t *testing.T) {
+			data := responseType{}
+			if err := New(ts.URL + path).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if expected := (responseType{OK: true, Animal: "platypus"}); data != expected {
+				t.Errorf("Expected %v, got %v", expected, data)
+			}
+		})
+	}
+
+	t.Run("explicit format", func(t *testing.T) {
+		var data []byte
+		if err := New(ts.URL + "/json").ResponseFormat(ResponseFormatBytes).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := payloads["/json"]; string(data) != expected {
+			t.Errorf("Expected %v, got %v", expected, string(data))
+		}
+	})
+}
+
+func benchmarkDecodeBufferSize(b *testing.B, size int) {
+	var items []string
+	for i := 0; i < 5000; i++ {
+		items = append(items, fmt.Sprintf(`<responseType><ok>true</ok><animal>platypus %d</animal></responseType>`, i))
+	}
+	payload := []byte("<list>" + strings.Join(items, "") + "</list>")
+	header := http.Header{"Content-Type": []string{"application/xml"}}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := struct {
+			Items []responseType `xml:"responseType"`
+		}{}
+		if err := New("http://www.example.com").Replay(http.StatusOK, header, payload).DecodeBufferSize(size).Do(&data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRekwest_DecodeBufferSizeDefault(b *testing.B) {
+	benchmarkDecodeBufferSize(b, 0)
+}
+
+func BenchmarkRekwest_DecodeBufferSize64K(b *testing.B) {
+	benchmarkDecodeBufferSize(b, 1<<16)
+}
+
+func TestRekwest_IfUnmodifiedSince(t *testing.T) {
+	modified := time.Date(2019, time.March, 4, 12, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if modified.After(since) {
+			http.Error(w, "modified", http.StatusPreconditionFailed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	if err := New(ts.URL).Method(http.MethodPut).IfUnmodifiedSince(modified.In(time.FixedZone("CET", 3600))).Do(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	err := New(ts.URL).Method(http.MethodPut).IfUnmodifiedSince(modified.Add(-time.Hour)).Do()
+	if !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+	if err == nil || err.Error() != "request failed with status 412: modified\n" {
+		t.Errorf("Unexpected error message %v", err)
+	}
+}
+
+var benchmarkHeaders = map[string]string{
+	"X-One":    "1",
+	"X-Two":    "2",
+	"X-Three":  "3",
+	"X-Four":   "4",
+	"X-Five":   "5",
+	"X-Six":    "6",
+	"X-Seven":  "7",
+	"X-Eight":  "8",
+	"X-Nine":   "9",
+	"X-Ten":    "10",
+	"X-Eleven": "11",
+	"X-Twelve": "12",
+}
+
+var benchmarkResult Rekwest
+
+func BenchmarkNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkResult = New("http://www.example.com").BearerToken("secret")
+	}
+}
+
+func BenchmarkRekwest_Headers(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkResult = New("http://www.example.com").Headers(benchmarkHeaders)
+	}
+}
+
+func TestRekwest_StatusCode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	for _, status := range []int{http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusNotModified, http.StatusNotFound} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			r := New(ts.URL).Query("status", strconv.Itoa(status))
+			if r.StatusCode() != 0 {
+				t.Errorf("Expected no status before calling Do, got %d", r.StatusCode())
+			}
+			err := r.Do()
+			if status < http.StatusBadRequest && err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if r.StatusCode() != status {
+				t.Errorf("Expected status %d, got %d", status, r.StatusCode())
+			}
+		})
+	}
+
+	t.Run("no response", func(t *testing.T) {
+		r := New("http://127.0.0.1:0")
+		if err := r.Do(); err == nil {
+			t.Error("Expected an error")
+		}
+		if r.StatusCode() != 0 {
+			t.Errorf("Expected no status, got %d", r.StatusCode())
+		}
+	})
+}
+
+func TestRekwest_ResponseBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL)
+	if r.ResponseBody() != nil {
+		t.Errorf("Expected no body before calling Do, got %v", r.ResponseBody())
+	}
+	first, second := responseType{}, map[string]interface{}{}
+	if err := r.Do(&first, &second); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := (responseType{OK: true, Animal: "platypus"}); first != expected {
+		t.Errorf("Expected %v, got %v", expected, first)
+	}
+	if expected := map[string]interface{}{"ok": true, "animal": "platypus"}; !reflect.DeepEqual(expected, second) {
+		t.Errorf("Expected %v, got %v", expected, second)
+	}
+
+	body := r.ResponseBody()
+	if expected := `{"ok":true,"animal":"platypus"}`; string(body) != expected {
+		t.Errorf("Expected body %v, got %v", expected, string(body))
+	}
+	body[0] = '['
+	if r.ResponseBody()[0] != '{' {
+		t.Error("Expected returned body to be a copy")
+	}
+}
+
+func TestRekwest_ResponseHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `</animals?page=2>; rel="next"`)
+		w.Header().Add("Link", `</animals?page=9>; rel="last"`)
+		w.Header().Set("X-Ratelimit-Remaining", "41")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL)
+	if r.ResponseHeaders() != nil {
+		t.Errorf("Expected no headers before calling Do, got %v", r.ResponseHeaders())
+	}
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	header := r.ResponseHeaders()
+	if expected := []string{`</animals?page=2>; rel="next"`, `</animals?page=9>; rel="last"`}; !reflect.DeepEqual(expected, header["Link"]) {
+		t.Errorf("Expected Link headers %v, got %v", expected, header["Link"])
+	}
+	if header.Get("X-Ratelimit-Remaining") != "41" {
+		t.Errorf("Expected rate limit header, got %v", header)
+	}
+
+	header.Set("X-Ratelimit-Remaining", "0")
+	if r.ResponseHeaders().Get("X-Ratelimit-Remaining") != "41" {
+		t.Error("Expected returned headers to be a copy")
+	}
+}
+
+func TestRekwest_ResponseCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session",
+			Value:    "platypus",
+			Path:     "/api",
+			MaxAge:   3600,
+			HttpOnly: true,
+			Secure:   true,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL)
+	if r.ResponseCookies() != nil {
+		t.Errorf("Expected no cookies before calling Do, got %v", r.ResponseCookies())
+	}
+	if err := r.Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cookies := r.ResponseCookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a single cookie, got %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Name != "session" || cookie.Value != "platypus" {
+		t.Errorf("Unexpected cookie %v", cookie)
+	}
+	if cookie.Path != "/api" || cookie.MaxAge != 3600 || !cookie.HttpOnly || !cookie.Secure {
+		t.Errorf("Unexpected cookie attributes %v", cookie)
+	}
+}
+
+func TestRekwest_ResponseCookiesSession(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123", HttpOnly: true})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user":"platypus"}`))
+	})
+	mux.HandleFunc("/profile", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"animal":"platypus"}`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	var login map[string]string
+	r := New(ts.URL + "/login").Method(http.MethodPost)
+	if err := r.Do(&login); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if login["user"] != "platypus" {
+		t.Errorf("Unexpected response %v", login)
+	}
+
+	var profile map[string]string
+	err := New(ts.URL + "/profile").
+		Cookies(r.ResponseCookies()...).
+		Do(&profile)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if profile["animal"] != "platypus" {
+		t.Errorf("Unexpected response %v", profile)
+	}
+}
+
+func TestRekwest_CookieJar(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc123", Path: "/"})
+	})
+	mux.HandleFunc("/profile", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	client := &http.Client{Timeout: time.Second}
+
+	if err := New(ts.URL + "/login").Client(client).CookieJar(jar).Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := New(ts.URL + "/profile").Client(client).CookieJar(jar).ResponseHeaderTimeout(time.Second).Do(); err != nil {
+		t.Errorf("Expected session cookie to be sent, got %v", err)
+	}
+	if client.Jar != nil {
+		t.Errorf("Expected given client not to be mutated, got jar %v", client.Jar)
+	}
+	if err := New(ts.URL + "/profile").Client(client).Do(); err == nil {
+		t.Error("Expected session cookie not to be sent without jar")
+	}
+}
+
+func TestRekwest_Path(t *testing.T) {
+	var requestURI string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		base     string
+		segments []string
+		expected string
+	}{
+		{"segments", "/api", []string{"animals", "42"}, "/api/animals/42"},
+		{"slashes", "/api/", []string{"/animals/", "/42"}, "/api/animals/42"},
+		{"trailing slash", "/api", []string{"animals/"}, "/api/animals/"},
+		{"query", "/api?key=secret", []string{"animals"}, "/api/animals?key=secret"},
+		{"escaping", "/api", []string{"duck billed", "what?"}, "/api/duck%20billed/what%3F"},
+		{"no base path", "", []string{"animals"}, "/animals"},
+		{"escaped segment", "/api", []string{"duck%2Fbilled"}, "/api/duck%2Fbilled"},
+		{"dots in segment", "/api", []string{"v1.2", "...", ".well-known"}, "/api/v1.2/.../.well-known"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := New(ts.URL + test.base).Path(test.segments...).Do(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if requestURI != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, requestURI)
+			}
+		})
+	}
+
+	for _, segments := range [][]string{{"100%"}, {"..", "..", "admin"}, {"users/../../admin"}, {"%2e%2e", "admin"}, {"."}} {
+		requestURI = ""
+		err := New(ts.URL + "/api/v1").Path(segments...).Do()
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+			t.Errorf("Expected a single build error for %q, got %v", segments, err)
+		}
+		if requestURI != "" {
+			t.Errorf("Expected no request to escape the base path for %q, got %v", segments, requestURI)
+		}
+	}
+}
+
+func TestMethodConstructors(t *testing.T) {
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		constructor func(string) Rekwest
+		expected    string
+	}{
+		{Get, http.MethodGet},
+		{Head, http.MethodHead},
+		{Post, http.MethodPost},
+		{Put, http.MethodPut},
+		{Patch, http.MethodPatch},
+		{Delete, http.MethodDelete},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			if err := test.constructor(ts.URL).Do(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if method != test.expected {
+				t.Errorf("Expected method %s, got %s", test.expected, method)
+			}
+		})
+	}
+}
+
+func TestRekwest_DoJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Accept") != "application/json" {
+			http.Error(w, "expected JSON", http.StatusUnsupportedMediaType)
+			return
+		}
+		data := responseType{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data.OK = r.Method == http.MethodPost
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer ts.Close()
+
+	t.Run("post", func(t *testing.T) {
+		data := responseType{}
+		if err := New(ts.URL).DoJSON(responseType{Animal: "platypus"}, &data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := (responseType{OK: true, Animal: "platypus"}); data != expected {
+			t.Errorf("Expected %v, got %v", expected, data)
+		}
+	})
+
+	t.Run("explicit method", func(t *testing.T) {
+		data := responseType{}
+		if err := New(ts.URL).Method(http.MethodPut).DoJSON(responseType{Animal: "dog"}, &data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := (responseType{OK: false, Animal: "dog"}); data != expected {
+			t.Errorf("Expected %v, got %v", expected, data)
+		}
+	})
+}
+
+func TestDefaultResponseFormat(t *testing.T) {
+	var accept string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	defer func(format ResponseFormat) {
+		DefaultResponseFormat = format
+	}(DefaultResponseFormat)
+	DefaultResponseFormat = ResponseFormatJSON
+
+	t.Run("default", func(t *testing.T) {
+		data := responseType{}
+		if err := New(ts.URL).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := (responseType{OK: true, Animal: "platypus"}); data != expected {
+			t.Errorf("Expected %v, got %v", expected, data)
+		}
+		if accept != acceptJSON {
+			t.Errorf("Expected Accept header %v, got %v", acceptJSON, accept)
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		var data []byte
+		if err := New(ts.URL).ResponseFormat(ResponseFormatContentType).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := `{"ok":true,"animal":"platypus"}`; string(data) != expected {
+			t.Errorf("Expected %v, got %v", expected, string(data))
+		}
+	})
+
+	t.Run("override accept", func(t *testing.T) {
+		New(ts.URL).ResponseFormat(ResponseFormatXML).Do()
+		if accept != acceptXML {
+			t.Errorf("Expected Accept header %v, got %v", acceptXML, accept)
+		}
+	})
+}
+
+func TestInFlight(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+
+	baseline := InFlight()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := New(ts.URL).Do(); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for InFlight() != baseline+5 {
+		if time.Now().After(deadline) {
+			t.Errorf("Expected %d requests in flight, got %d", baseline+5, InFlight())
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+	if count := InFlight(); count != baseline {
+		t.Errorf("Expected %d requests in flight, got %d", baseline, count)
+	}
+}
+
+func TestInFlightMethods(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]func(Rekwest) error{
+		"raw": func(r Rekwest) error {
+			res, err := r.Raw()
+			if err == nil {
+				res.Body.Close()
+			}
+			return err
+		},
+		"poll": func(r Rekwest) error {
+			return r.PollUntil(nil, time.Millisecond, nil)
+		},
+		"download": func(r Rekwest) error {
+			return r.DownloadResumable(filepath.Join(dir, "animals.txt"))
+		},
+		"upgrade": func(r Rekwest) error {
+			conn, _, err := r.Upgrade("websocket")
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		},
+	}
+	for name, send := range tests {
+		t.Run(name, func(t *testing.T) {
+			release := make(chan struct{})
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			}))
+			defer ts.Close()
+
+			baseline := InFlight()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				send(New(ts.URL))
+			}()
+
+			deadline := time.Now().Add(time.Second)
+			for InFlight() != baseline+1 {
+				if time.Now().After(deadline) {
+					t.Errorf("Expected %d requests in flight, got %d", baseline+1, InFlight())
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+			<-done
+			if count := InFlight(); count != baseline {
+				t.Errorf("Expected %d requests in flight, got %d", baseline, count)
+			}
+		})
+	}
+}
+
+func TestRekwest_RawMessages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"type":"animal","animal":"platypus","ok":true},{"type":"count","count":3}]`))
+	}))
+	defer ts.Close()
+
+	var elements []json.RawMessage
+	if err := New(ts.URL).Do(&elements); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(elements) != 2 {
+		t.Fatalf("Expected 2 elements, got %d", len(elements))
+	}
+
+	var animal responseType
+	var count int
+	for _, element := range elements {
+		discriminator := struct {
+			Type string `json:"type"`
+		}{}
+		if err := json.Unmarshal(element, &discriminator); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		switch discriminator.Type {
+		case "animal":
+			if err := json.Unmarshal(element, &animal); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		case "count":
+			value := struct {
+				Count int `json:"count"`
+			}{}
+			if err := json.Unmarshal(element, &value); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			count = value.Count
+		}
+	}
+	if expected := (responseType{OK: true, Animal: "platypus"}); animal != expected {
+		t.Errorf("Expected %v, got %v", expected, animal)
+	}
+	if count != 3 {
+		t.Errorf("Expected count of 3, got %d", count)
+	}
 }
@@ -0,0 +1,56 @@
+package rekwest
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+func (r *request) CompressRequestOver(n int) Rekwest {
+	r.compress = n > 0
+	r.compressOver = n
+	return r
+}
+
+func (r *request) GzipBody() Rekwest {
+	r.compress = true
+	r.compressOver = 0
+	return r
+}
+
+func (r *request) CompressMultipart() Rekwest {
+	r.compressMultipart = true
+	return r
+}
+
+// compressedBody returns the gzipped in memory body in case compression
+// is requested and the body exceeds the configured threshold. Otherwise
+// nil is returned, which includes empty bodies.
+func (r *request) compressedBody() ([]byte, error) {
+	if !r.compress {
+		return nil, nil
+	}
+	var data []byte
+	switch {
+	case r.pooledBody != nil:
+		data = r.pooledBody.buf.Bytes()
+	case r.bodyBytes != nil:
+		data = r.bodyBytes
+	}
+	if len(data) == 0 || len(data) <= r.compressOver {
+		return nil, nil
+	}
+	return gzipData(data)
+}
+
+// gzipData returns the given data compressed using gzip.
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
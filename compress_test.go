@@ -0,0 +1,154 @@
+package rekwest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRekwest_CompressRequestOver(t *testing.T) {
+	var encoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	payload := strings.Repeat("platypus", 64)
+	tests := []struct {
+		name             string
+		request          Rekwest
+		expectedEncoding string
+	}{
+		{
+			"above threshold",
+			New(ts.URL).Method(http.MethodPost).BytesBody([]byte(payload)).CompressRequestOver(128),
+			"gzip",
+		},
+		{
+			"above threshold pooled",
+			New(ts.URL).Method(http.MethodPost).JSONBody(payload).CompressRequestOver(128),
+			"gzip",
+		},
+		{
+			"below threshold",
+			New(ts.URL).Method(http.MethodPost).BytesBody([]byte(payload)).CompressRequestOver(1024),
+			"",
+		},
+		{
+			"streamed body",
+			New(ts.URL).Method(http.MethodPost).Body(strings.NewReader(payload)).CompressRequestOver(128),
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			if err := test.request.ResponseFormat(ResponseFormatBytes).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if encoding != test.expectedEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", test.expectedEncoding, encoding)
+			}
+			if !strings.Contains(string(data), payload) {
+				t.Errorf("Expected payload to be received, got %v", string(data))
+			}
+		})
+	}
+}
+
+func TestRekwest_GzipBody(t *testing.T) {
+	var encoding string
+	var length int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		length = r.ContentLength
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(b)) != length {
+			http.Error(w, "unexpected body length", http.StatusBadRequest)
+			return
+		}
+		if encoding == "gzip" {
+			gz, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if b, err = ioutil.ReadAll(gz); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name             string
+		request          Rekwest
+		expectedBody     string
+		expectedEncoding string
+	}{
+		{
+			"json",
+			New(ts.URL).Method(http.MethodPost).JSONBody("platypus").GzipBody(),
+			`"platypus"`,
+			"gzip",
+		},
+		{
+			"xml",
+			New(ts.URL).Method(http.MethodPost).XMLBody(responseType{Animal: "platypus"}).GzipBody(),
+			"<responseType><ok>false</ok><animal>platypus</animal></responseType>",
+			"gzip",
+		},
+		{
+			"bytes",
+			New(ts.URL).Method(http.MethodPost).BytesBody([]byte("platypus")).GzipBody(),
+			"platypus",
+			"gzip",
+		},
+		{
+			"empty",
+			New(ts.URL).Method(http.MethodPost).BytesBody([]byte{}).GzipBody(),
+			"",
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			if err := test.request.ResponseFormat(ResponseFormatBytes).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if encoding != test.expectedEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", test.expectedEncoding, encoding)
+			}
+			if strings.TrimSpace(string(data)) != test.expectedBody {
+				t.Errorf("Expected body %q, got %q", test.expectedBody, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package rekwest
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// redactedHeaders contains headers whose values are never written
+// when rendering a request or response for debugging.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// curlCommand renders a curl command reproducing the given request using
+// the given body. Credentials are redacted.
+func curlCommand(req *http.Request, body []byte) string {
+	parts := []string{"curl", "-X", req.Method, shellQuote(redactedURL(req))}
+
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			if redactedHeaders[http.CanonicalHeaderKey(key)] {
+				value = "[REDACTED]"
+			}
+			parts = append(parts, "-H", shellQuote(key+": "+value))
+		}
+	}
+
+	if len(body) != 0 {
+		parts = append(parts, "--data-binary", shellQuote(string(body)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,63 @@
+package rekwest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decompressBody replaces the body of a response using a supported
+// Content-Encoding with a reader decompressing it. Transports decompressing
+// responses themselves remove the header, so those are passed through. It
+// reports whether the body has been replaced.
+func decompressBody(res *http.Response) bool {
+	var open func(io.Reader) (io.ReadCloser, error)
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		open = func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		}
+	case "deflate":
+		open = zlib.NewReader
+	default:
+		return false
+	}
+	if res.Body == nil || res.Body == http.NoBody {
+		return false
+	}
+	res.Body = &decompressedBody{body: res.Body, open: open}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return true
+}
+
+// decompressedBody decompresses the underlying body. The decompressing
+// reader is created on first read, so empty bodies can still be closed
+// without an error.
+type decompressedBody struct {
+	body   io.ReadCloser
+	open   func(io.Reader) (io.ReadCloser, error)
+	reader io.ReadCloser
+	err    error
+}
+
+func (d *decompressedBody) Read(p []byte) (int, error) {
+	if d.reader == nil && d.err == nil {
+		d.reader, d.err = d.open(d.body)
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.reader.Read(p)
+}
+
+func (d *decompressedBody) Close() error {
+	if d.reader != nil {
+		d.reader.Close()
+	}
+	return d.body.Close()
+}
@@ -0,0 +1,89 @@
+package rekwest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// closeRecorder records whether the body it wraps has been closed.
+type closeRecorder struct {
+	io.ReadCloser
+	closed *bool
+}
+
+func (c closeRecorder) Close() error {
+	*c.closed = true
+	return c.ReadCloser.Close()
+}
+
+func TestRekwest_Decompress(t *testing.T) {
+	payload := []byte(`{"ok":true,"animal":"platypus"}`)
+	var gzipped, deflated bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(payload)
+	gz.Close()
+	zl := zlib.NewWriter(&deflated)
+	zl.Write(payload)
+	zl.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		format   ResponseFormat
+	}{
+		{"gzip", "gzip", gzipped.Bytes(), ResponseFormatContentType},
+		{"gzip json", "gzip", gzipped.Bytes(), ResponseFormatJSON},
+		{"deflate", "deflate", deflated.Bytes(), ResponseFormatContentType},
+		{"identity", "", payload, ResponseFormatContentType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if test.encoding != "" {
+					w.Header().Set("Content-Encoding", test.encoding)
+				}
+				w.Write(test.body)
+			}))
+			defer ts.Close()
+
+			var data responseType
+			client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			if err := New(ts.URL).Client(client).ResponseFormat(test.format).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !data.OK || data.Animal != "platypus" {
+				t.Errorf("Unexpected response %v", data)
+			}
+		})
+	}
+
+	t.Run("close", func(t *testing.T) {
+		var closed bool
+		res := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{"gzip"}},
+			Body:   closeRecorder{ioutil.NopCloser(bytes.NewReader(gzipped.Bytes())), &closed},
+		}
+		if !decompressBody(res) {
+			t.Fatal("Expected body to be decompressed")
+		}
+		if res.Header.Get("Content-Encoding") != "" || !res.Uncompressed {
+			t.Errorf("Expected response to be marked as uncompressed, got %v", res.Header)
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil || !bytes.Equal(b, payload) {
+			t.Errorf("Unexpected body %q and error %v", b, err)
+		}
+		res.Body.Close()
+		if !closed {
+			t.Error("Expected underlying body to be closed")
+		}
+	})
+}
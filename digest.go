@@ -0,0 +1,60 @@
+package rekwest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// verifyDigest checks the given body against the digests sent in the
+// Content-MD5 and Digest headers of the response. In case none of the
+// headers is present, no verification happens.
+func verifyDigest(header http.Header, body []byte) error {
+	expected := map[string]string{}
+	if value := header.Get("Content-MD5"); value != "" {
+		expected["md5"] = strings.TrimSpace(value)
+	}
+	for _, value := range header.Values("Digest") {
+		for _, instance := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(instance), "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("malformed digest %q", instance)
+			}
+			expected[strings.ToLower(parts[0])] = parts[1]
+		}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+
+	verified := false
+	for algorithm, digest := range expected {
+		newHash, ok := digestAlgorithms[algorithm]
+		if !ok {
+			continue
+		}
+		h := newHash()
+		h.Write(body)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != digest {
+			return fmt.Errorf("response body does not match %s digest %s", algorithm, digest)
+		}
+		verified = true
+	}
+	if !verified {
+		return fmt.Errorf("response does not contain a digest using a supported algorithm")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package rekwest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func (r *request) DownloadResumable(path string) (err error) {
+	defer func() {
+		r.finish(err)
+	}()
+
+	if !r.OK() {
+		return fmt.Errorf("could not perform request: %w", r.multiErr)
+	}
+
+	var offset int64
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		offset = info.Size()
+	case !os.IsNotExist(err):
+		return fmt.Errorf("could not inspect download target: %w", err)
+	}
+	var validator string
+	if offset > 0 {
+		// a validator is stored when the partial download has been started,
+		// so that a changed resource is sent in its entirety instead of
+		// appending a range of it
+		if b, err := ioutil.ReadFile(validatorPath(path)); err == nil && len(b) != 0 {
+			validator = string(b)
+		}
+	}
+
+	timeout, cancel := r.timeoutContext()
+	defer cancel()
+
+	// the range only applies to this download, so it is not added to the
+	// headers of the request, which might be performed again
+	res, err := r.perform(timeout, func() (*http.Request, error) {
+		req, err := r.newRequest()
+		if err != nil || offset == 0 {
+			return req, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	r.response = res
+	defer res.Body.Close()
+
+	// servers not supporting ranges send the entire resource, which replaces
+	// the partial download
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		contentRange, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || contentRange.Start != offset {
+			return fmt.Errorf("could not resume download at offset %d, received range %q", offset, res.Header.Get("Content-Range"))
+		}
+		if etag := res.Header.Get("ETag"); strings.HasPrefix(validator, `"`) && etag != "" && etag != validator {
+			return fmt.Errorf("could not resume download, resource has changed from %s to %s", validator, etag)
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the download has been completed before
+		if offset > 0 && res.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			os.Remove(validatorPath(path))
+			return nil
+		}
+	}
+	if r.errorStatus(res.StatusCode) {
+		return r.handleResponse(timeout, res, nil)
+	}
+
+	if res.StatusCode != http.StatusPartialContent {
+		if validator := rangeValidator(res); validator != "" {
+			if err := ioutil.WriteFile(validatorPath(path), []byte(validator), 0644); err != nil {
+				return fmt.Errorf("could not store download validator: %w", err)
+			}
+		} else {
+			os.Remove(validatorPath(path))
+		}
+	}
+
+	var body io.Reader = res.Body
+	if r.maxBytes > 0 {
+		body = &limitedBody{ReadCloser: res.Body, limit: r.maxBytes}
+	}
+	if err := writeFile(path, flags, body); err != nil {
+		if timeout.Err() != nil {
+			err = timeout.doneErr(r.context)
+		}
+		r.multiErr.append(phaseDecode, err)
+		return fmt.Errorf("error handling the response: %w", r.multiErr)
+	}
+	os.Remove(validatorPath(path))
+	return nil
+}
+
+// validatorPath returns the path of the file storing the validator of an
+// incomplete download at path.
+func validatorPath(path string) string {
+	return path + ".validator"
+}
+
+// rangeValidator returns the value to send as If-Range when resuming the
+// download of the given response, which is empty in case the server does
+// not support ranges or has not sent a strong validator.
+func rangeValidator(res *http.Response) string {
+	if !strings.EqualFold(res.Header.Get("Accept-Ranges"), "bytes") {
+		return ""
+	}
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return res.Header.Get("Last-Modified")
+}
+
+// writeFile copies the given body into the file at path, which is opened
+// using the given flags.
+func writeFile(path string, flags int, body io.Reader) error {
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,139 @@
+package rekwest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRekwest_DownloadResumable(t *testing.T) {
+	content := []byte(strings.Repeat("platypus", 1024))
+	interrupt := true
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if interrupt {
+			// announce the entire resource but stop halfway through
+			interrupt = false
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			return
+		}
+		http.ServeContent(w, r, "animals.txt", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "animals.txt")
+	if err := New(ts.URL).DownloadResumable(path); err == nil {
+		t.Fatal("Expected interrupted download to fail")
+	}
+	if err := New(ts.URL).DownloadResumable(path); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := New(ts.URL).DownloadResumable(path); err != nil {
+		t.Fatalf("Unexpected error resuming a complete download %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("Expected downloaded file to equal content, got %d bytes", len(b))
+	}
+	expected := []string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-", "bytes=" + strconv.Itoa(len(content)) + "-"}
+	if strings.Join(ranges, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected Range headers %v, got %v", expected, ranges)
+	}
+}
+
+func TestRekwest_DownloadResumableFallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("platypus"))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "animal.txt")
+	if err := ioutil.WriteFile(path, []byte("plat"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := New(ts.URL).DownloadResumable(path); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "platypus" {
+		t.Errorf("Expected file to be replaced, got %q", string(b))
+	}
+}
+
+func TestRekwest_DownloadResumableChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		etag     string
+		expected string
+		status   int
+	}{
+		{"unchanged resource", `"v1"`, strings.Repeat("platypus", 1024), http.StatusPartialContent},
+		{"changed resource", `"v2"`, strings.Repeat("capybara", 1024), http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := []byte(strings.Repeat("platypus", 1024))
+			interrupt := true
+			var ifRanges []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+				w.Header().Set("Accept-Ranges", "bytes")
+				if interrupt {
+					interrupt = false
+					w.Header().Set("ETag", `"v1"`)
+					w.Header().Set("Content-Length", strconv.Itoa(len(original)))
+					w.Write(original[:len(original)/2])
+					return
+				}
+				w.Header().Set("ETag", test.etag)
+				http.ServeContent(w, r, "animals.txt", time.Time{}, strings.NewReader(test.expected))
+			}))
+			defer ts.Close()
+
+			path := filepath.Join(t.TempDir(), "animals.txt")
+			if err := New(ts.URL).DownloadResumable(path); err == nil {
+				t.Fatal("Expected interrupted download to fail")
+			}
+			req := New(ts.URL)
+			if err := req.DownloadResumable(path); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if req.StatusCode() != test.status {
+				t.Errorf("Expected status %d, got %d", test.status, req.StatusCode())
+			}
+			if b, _ := ioutil.ReadFile(path); string(b) != test.expected {
+				t.Errorf("Expected downloaded file to equal content, got %d bytes", len(b))
+			}
+			if expected := []string{"", `"v1"`}; strings.Join(ifRanges, ",") != strings.Join(expected, ",") {
+				t.Errorf("Expected If-Range headers %v, got %v", expected, ifRanges)
+			}
+			if _, err := ioutil.ReadFile(validatorPath(path)); err == nil {
+				t.Error("Expected validator to be removed after completing the download")
+			}
+
+			// the range of the download is not sent by subsequent requests
+			ifRanges = nil
+			var data []byte
+			if err := req.Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if len(ifRanges) != 1 || ifRanges[0] != "" {
+				t.Errorf("Expected no If-Range header after downloading, got %v", ifRanges)
+			}
+			if req.StatusCode() != http.StatusOK || string(data) != test.expected {
+				t.Errorf("Expected entire resource to be requested after downloading, got status %d", req.StatusCode())
+			}
+		})
+	}
+}
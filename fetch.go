@@ -0,0 +1,23 @@
+package rekwest
+
+import (
+	"context"
+	"net/http"
+)
+
+// Option configures a Rekwest, e.g. when using Fetch.
+type Option func(Rekwest)
+
+// Fetch performs a request against the given URL using the given context,
+// decoding the response into a value of type T. Options are applied in order
+// before performing the request. The returned response has its body already
+// consumed and closed, and is nil in case no response has been received.
+func Fetch[T any](ctx context.Context, url string, opts ...Option) (T, *http.Response, error) {
+	r := New(url).Context(ctx)
+	for _, opt := range opts {
+		opt(r)
+	}
+	var target T
+	err := r.Do(&target)
+	return target, r.(*request).response, err
+}
@@ -0,0 +1,67 @@
+package rekwest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "bad Authorization header", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/animal":
+			w.Header().Set("X-Animal", "platypus")
+			w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+		case "/animals":
+			w.Write([]byte(`[{"ok":true,"animal":"platypus"},{"ok":false,"animal":"dog"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	auth := func(r Rekwest) {
+		r.BearerToken("secret")
+	}
+
+	t.Run("struct", func(t *testing.T) {
+		animal, res, err := Fetch[responseType](context.Background(), ts.URL+"/animal", auth)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := (responseType{OK: true, Animal: "platypus"}); animal != expected {
+			t.Errorf("Expected %v, got %v", expected, animal)
+		}
+		if res == nil || res.StatusCode != http.StatusOK || res.Header.Get("X-Animal") != "platypus" {
+			t.Errorf("Unexpected response %v", res)
+		}
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		animals, _, err := Fetch[[]responseType](context.Background(), ts.URL+"/animals", auth)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		expected := []responseType{{OK: true, Animal: "platypus"}, {OK: false, Animal: "dog"}}
+		if !reflect.DeepEqual(expected, animals) {
+			t.Errorf("Expected %v, got %v", expected, animals)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, res, err := Fetch[responseType](context.Background(), ts.URL+"/animal")
+		if err == nil {
+			t.Error("Expected error, got nil")
+		}
+		if res == nil || res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Unexpected response %v", res)
+		}
+	})
+}
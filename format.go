@@ -0,0 +1,76 @@
+package rekwest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// format is a codec for payloads of a certain media type.
+type format struct {
+	target targetFormat
+	decode func(io.Reader, interface{}) error
+	encode func(interface{}) ([]byte, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]format{
+		"application/json": {targetFormatJSON, decodeJSON, json.Marshal},
+		"application/xml":  {targetFormatXML, decodeXML, xml.Marshal},
+		"text/xml":         {targetFormatXML, decodeXML, xml.Marshal},
+	}
+)
+
+// RegisterFormat registers the given decode and encode funcs for payloads of
+// the given media type, e.g. for adding support for CBOR or TOML. Responses
+// using the media type are decoded using decode when the response format
+// is inferred from the content type, encode is used by FormatBody.
+// Registering a media type that is already known replaces its codec.
+// It is safe to call RegisterFormat concurrently.
+func RegisterFormat(mediaType string, decode func(io.Reader, interface{}) error, encode func(interface{}) ([]byte, error)) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[mediaType] = format{targetFormat(mediaType), decode, encode}
+}
+
+// lookupFormat returns the format registered for the given media type.
+func lookupFormat(mediaType string) (format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[mediaType]
+	return f, ok
+}
+
+func (r *request) FormatBody(mediaType string, data interface{}) Rekwest {
+	f, ok := lookupFormat(mediaType)
+	if !ok || f.encode == nil {
+		r.buildError(fmt.Errorf("no encoder registered for media type %s", mediaType))
+		return r
+	}
+	r.contentType = mediaType
+	return r.MarshalBody(data, f.encode)
+}
+
+func decodeJSON(body io.Reader, target interface{}) error {
+	return json.NewDecoder(body).Decode(target)
+}
+
+func decodeXML(body io.Reader, target interface{}) error {
+	return xml.NewDecoder(body).Decode(target)
+}
+
+// AsFormat returns a target for `Do` that decodes the response onto the given
+// target using the given format instead of the request's response format,
+// e.g. for decoding a JSON response into a struct and keeping the raw bytes
+// in the same call.
+func AsFormat(format ResponseFormat, target interface{}) interface{} {
+	return &formatTarget{format, target}
+}
+
+type formatTarget struct {
+	format ResponseFormat
+	target interface{}
+}
@@ -0,0 +1,191 @@
+package rekwest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFormat(t *testing.T) {
+	// the test format encodes a pointer to a string as key=value
+	RegisterFormat(
+		"application/x-rekwest-test",
+		func(r io.Reader, target interface{}) error {
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			s, ok := target.(*string)
+			if !ok || !strings.HasPrefix(string(b), "value=") {
+				return errors.New("unexpected payload")
+			}
+			*s = strings.TrimPrefix(string(b), "value=")
+			return nil
+		},
+		func(data interface{}) ([]byte, error) {
+			s, ok := data.(string)
+			if !ok {
+				return nil, errors.New("unexpected data")
+			}
+			return []byte("value=" + s), nil
+		},
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type")+"; charset=utf-8")
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	t.Run("round trip", func(t *testing.T) {
+		var data string
+		if err := New(ts.URL).Method(http.MethodPost).FormatBody("application/x-rekwest-test", "platypus").Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if data != "platypus" {
+			t.Errorf("Expected platypus, got %v", data)
+		}
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		var data int
+		err := New(ts.URL).Method(http.MethodPost).FormatBody("application/x-rekwest-test", "platypus").Do(&data)
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.DecodeErrors()) != 1 {
+			t.Errorf("Expected a decode error, got %v", err)
+		}
+	})
+
+	t.Run("built in", func(t *testing.T) {
+		data := responseType{}
+		if err := New(ts.URL).Method(http.MethodPost).FormatBody("application/json", responseType{OK: true}).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !data.OK {
+			t.Errorf("Expected data to be decoded, got %v", data)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		err := New(ts.URL).FormatBody("application/x-unknown", "platypus").Do()
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+			t.Errorf("Expected a build error, got %v", err)
+		}
+	})
+}
+
+// animalName decodes plain text and JSON responses itself.
+type animalName string
+
+func (a *animalName) UnmarshalRekwest(contentType string, body []byte) error {
+	if strings.HasPrefix(contentType, "application/json") {
+		data := responseType{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return err
+		}
+		*a = animalName(data.Animal)
+		return nil
+	}
+	if strings.HasPrefix(contentType, "text/plain") {
+		*a = animalName(body)
+		return nil
+	}
+	return fmt.Errorf("unsupported content type %s", contentType)
+}
+
+func TestRekwest_Unmarshaler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("platypus"))
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte("<animal>platypus</animal>"))
+		}
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/json", "/text"} {
+		t.Run(path, func(t *testing.T) {
+			var name animalName
+			if err := New(ts.URL + path).ResponseFormat(ResponseFormatBytes).Do(&name); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if name != "platypus" {
+				t.Errorf("Expected platypus, got %v", name)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		var name animalName
+		err := New(ts.URL + "/xml").Do(&name)
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.DecodeErrors()) != 1 {
+			t.Errorf("Expected a decode error, got %v", err)
+		}
+	})
+}
+
+func TestAsFormat(t *testing.T) {
+	payload := `{"ok":true,"animal":"platypus"}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	t.Run("json and bytes", func(t *testing.T) {
+		var data responseType
+		var raw []byte
+		if err := New(ts.URL).Do(&data, AsFormat(ResponseFormatBytes, &raw)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !data.OK || data.Animal != "platypus" {
+			t.Errorf("Unexpected response %v", data)
+		}
+		if string(raw) != payload {
+			t.Errorf("Expected raw body %q, got %q", payload, string(raw))
+		}
+	})
+	t.Run("multiple bytes", func(t *testing.T) {
+		var first, second []byte
+		if err := New(ts.URL).ResponseFormat(ResponseFormatBytes).Do(&first, &second); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(first) != payload || string(second) != payload {
+			t.Errorf("Expected each target to receive the body, got %q and %q", first, second)
+		}
+	})
+	t.Run("multiple json", func(t *testing.T) {
+		var data responseType
+		var generic map[string]interface{}
+		if err := New(ts.URL).Do(&data, &generic); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if data.Animal != "platypus" || generic["animal"] != "platypus" {
+			t.Errorf("Expected each target to be decoded, got %v and %v", data, generic)
+		}
+	})
+	t.Run("override bytes", func(t *testing.T) {
+		var raw []byte
+		var data responseType
+		if err := New(ts.URL).ResponseFormat(ResponseFormatBytes).Do(&raw, AsFormat(ResponseFormatJSON, &data)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(raw) != payload || data.Animal != "platypus" {
+			t.Errorf("Unexpected targets %q and %v", raw, data)
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package rekwest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HARLog collects the requests and responses recorded using HARRecorder
+// into a single HTTP Archive (HAR) log, which is written when closing it.
+// It is safe for concurrent use.
+type HARLog struct {
+	mu      sync.Mutex
+	w       io.Writer
+	entries []harEntry
+	closed  bool
+}
+
+// NewHARLog creates a HARLog that writes to the given writer on Close.
+func NewHARLog(w io.Writer) *HARLog {
+	return &HARLog{w: w}
+}
+
+// Close writes a HAR log containing all entries recorded so far, terminated
+// by a newline. Entries recorded after closing the log are discarded.
+func (l *HARLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	log := harLog{}
+	log.Log.Version = "1.2"
+	log.Log.Creator = harCreator{Name: "rekwest", Version: "1"}
+	log.Log.Entries = l.entries
+	if log.Log.Entries == nil {
+		log.Log.Entries = []harEntry{}
+	}
+	return json.NewEncoder(l.w).Encode(log)
+}
+
+func (l *HARLog) append(entry harEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.entries = append(l.entries, entry)
+	}
+}
+
+// harRecorder captures a request and its response for recording them as an
+// entry of a HAR log.
+type harRecorder struct {
+	log   *HARLog
+	start time.Time
+	body  bytes.Buffer
+
+	// the times of the network events of the last attempt, which are set
+	// by the transport
+	mu        sync.Mutex
+	connected time.Time
+	wrote     time.Time
+	firstByte time.Time
+}
+
+func (r *request) HARRecorder(log *HARLog) Rekwest {
+	r.har = &harRecorder{log: log}
+	return r
+}
+
+// begin starts recording a request, discarding anything recorded before, in
+// case the request is performed repeatedly.
+func (h *harRecorder) begin() {
+	h.start = time.Now()
+	h.body.Reset()
+	h.mu.Lock()
+	h.connected, h.wrote, h.firstByte = time.Time{}, time.Time{}, time.Time{}
+	h.mu.Unlock()
+}
+
+// trace returns a context measuring the network events of an attempt.
+func (h *harRecorder) trace(ctx context.Context) context.Context {
+	at := func(t *time.Time) {
+		h.mu.Lock()
+		*t = time.Now()
+		h.mu.Unlock()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			at(&h.connected)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			at(&h.wrote)
+		},
+		GotFirstResponseByte: func() {
+			at(&h.firstByte)
+		},
+	})
+}
+
+// timings splits the time from starting the request until now into the
+// phases of a HAR entry. Without network events, e.g. for replayed responses,
+// all of it is spent waiting.
+func (h *harRecorder) timings(now time.Time) harTimings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.connected.IsZero() || h.wrote.IsZero() || h.firstByte.IsZero() {
+		return harTimings{Blocked: -1, Wait: milliseconds(now.Sub(h.start))}
+	}
+	return harTimings{
+		Blocked: milliseconds(h.connected.Sub(h.start)),
+		Send:    milliseconds(h.wrote.Sub(h.connected)),
+		Wait:    milliseconds(h.firstByte.Sub(h.wrote)),
+		Receive: milliseconds(now.Sub(h.firstByte)),
+	}
+}
+
+// tee returns a body that captures all data read from the given body.
+func (h *harRecorder) tee(body io.ReadCloser) io.ReadCloser {
+	return &struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, &h.body), body}
+}
+
+// record appends an entry for the given request and response to the HAR log.
+// Credentials are redacted.
+func (h *harRecorder) record(req *http.Request, reqBody []byte, res *http.Response) {
+	request := harRequest{
+		Method:      req.Method,
+		URL:         redactedURL(req),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []struct{}{},
+		Headers:     harHeaders(req.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(reqBody),
+	}
+	if len(reqBody) != 0 {
+		request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(reqBody)}
+	}
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			request.QueryString = append(request.QueryString, harNameValue{key, value})
+		}
+	}
+	sort.Slice(request.QueryString, func(i, j int) bool {
+		return request.QueryString[i].Name < request.QueryString[j].Name
+	})
+
+	mimeType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	response := harResponse{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []struct{}{},
+		Headers:     harHeaders(res.Header),
+		Content: harContent{
+			Size:     h.body.Len(),
+			MimeType: mimeType,
+			Text:     h.body.String(),
+		},
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    h.body.Len(),
+	}
+	// the recorded body has been decompressed, so its size on the wire is
+	// unknown
+	if res.Uncompressed {
+		response.BodySize = -1
+	}
+	if res.ProtoMajor != 0 {
+		request.HTTPVersion = res.Proto
+		response.HTTPVersion = res.Proto
+	}
+
+	now := time.Now()
+	entry := harEntry{
+		StartedDateTime: h.start.Format(time.RFC3339Nano),
+		Time:            milliseconds(now.Sub(h.start)),
+		Request:         request,
+		Response:        response,
+		Cache:           struct{}{},
+		Timings:         h.timings(now),
+	}
+	h.log.append(entry)
+}
+
+// redactedURL returns the URL of the given request without user info.
+func redactedURL(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	return u.String()
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for key, values := range header {
+		for _, value := range values {
+			if redactedHeaders[http.CanonicalHeaderKey(key)] {
+				value = "[REDACTED]"
+			}
+			headers = append(headers, harNameValue{key, value})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+	return headers
+}
+
+func milliseconds(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+type harLog struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []struct{}     `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []struct{}     `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
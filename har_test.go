@@ -0,0 +1,157 @@
+package rekwest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRekwest_HARRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	log := NewHARLog(buf)
+	data := responseType{}
+	err := New(ts.URL + "/animals?kind=platypus").
+		Method(http.MethodPost).
+		BearerToken("secret").
+		JSONBody(responseType{Animal: "platypus"}).
+		HARRecorder(log).
+		Do(&data)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !data.OK {
+		t.Errorf("Expected response to be decoded when recording, got %v", data)
+	}
+	if err := New(ts.URL + "/zoos").HARRecorder(log).Do(&responseType{}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected log not to be written before closing, got %s", buf.String())
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Unexpected error closing HAR log %v", err)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("Expected credentials to be redacted, got %s", buf.String())
+	}
+
+	har := harLog{}
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("Unexpected error decoding HAR %v", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected two entries in a single HAR 1.2 log, got %v", har)
+	}
+	if url := har.Log.Entries[1].Request.URL; url != ts.URL+"/zoos" {
+		t.Errorf("Expected second entry to record the second request, got %v", url)
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.Method != http.MethodPost || entry.Request.URL != ts.URL+"/animals?kind=platypus" {
+		t.Errorf("Unexpected request %v", entry.Request)
+	}
+	if expected := []harNameValue{{"kind", "platypus"}}; len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0] != expected[0] {
+		t.Errorf("Expected query string %v, got %v", expected, entry.Request.QueryString)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"ok":false,"animal":"platypus"}` || entry.Request.PostData.MimeType != "application/json" {
+		t.Errorf("Unexpected post data %v", entry.Request.PostData)
+	}
+	authorized := false
+	for _, header := range entry.Request.Headers {
+		if header.Name == "Authorization" {
+			authorized = header.Value == "[REDACTED]"
+		}
+	}
+	if !authorized {
+		t.Errorf("Expected redacted Authorization header, got %v", entry.Request.Headers)
+	}
+	if entry.Response.Status != http.StatusOK || entry.Response.Content.MimeType != "application/json" || entry.Response.Content.Text != `{"ok":true,"animal":"platypus"}` {
+		t.Errorf("Unexpected response %v", entry.Response)
+	}
+	if entry.Time <= 0 {
+		t.Errorf("Expected entry to be timed, got %v", entry.Time)
+	}
+}
+
+func TestRekwest_HARRecorderEntries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/compressed":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte("platypus"))
+			gz.Close()
+		case "/jobs":
+			w.Header().Set("Location", "/jobs/1")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("abc"))
+		}
+	}))
+	defer ts.Close()
+
+	buf := &bytes.Buffer{}
+	log := NewHARLog(buf)
+	repeated := New(ts.URL).HARRecorder(log)
+	for i := 0; i < 2; i++ {
+		var data []byte
+		if err := repeated.Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	// the transport must not decompress the body, so the body received by
+	// the recorder is gzipped
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	var data []byte
+	if err := New(ts.URL+"/compressed").Client(client).Header("Accept-Encoding", "gzip").HARRecorder(log).Do(&data); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := New(ts.URL+"/jobs").HARRecorder(log).PollUntil(&data, time.Millisecond, func(res *http.Response) bool {
+		return res.Request.URL.Path == "/jobs/1"
+	}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Unexpected error closing HAR log %v", err)
+	}
+
+	har := harLog{}
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("Unexpected error decoding HAR %v", err)
+	}
+	if len(har.Log.Entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(har.Log.Entries))
+	}
+	for i, entry := range har.Log.Entries[:2] {
+		if entry.Response.Content.Text != "abc" {
+			t.Errorf("Expected entry %d to record the body of a single response, got %q", i, entry.Response.Content.Text)
+		}
+	}
+	if content := har.Log.Entries[2].Response.Content; content.Text != "platypus" || content.MimeType != "text/plain" {
+		t.Errorf("Expected decompressed body to be recorded, got %v", content)
+	}
+	for i, entry := range har.Log.Entries {
+		if started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime); err != nil || started.IsZero() || started.Year() < 2000 {
+			t.Errorf("Expected entry %d to have a start time, got %q", i, entry.StartedDateTime)
+		}
+		timings := entry.Timings
+		if timings.Send < 0 || timings.Wait < 0 || timings.Receive < 0 {
+			t.Errorf("Expected entry %d to have non-negative timings, got %v", i, timings)
+		}
+		if sum := timings.Blocked + timings.Send + timings.Wait + timings.Receive; sum > entry.Time+0.001 {
+			t.Errorf("Expected timings of entry %d to add up to at most %v, got %v", i, entry.Time, sum)
+		}
+	}
+}
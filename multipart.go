@@ -0,0 +1,188 @@
+package rekwest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"sync"
+)
+
+// MultipartBuilder adds fields and files to a multipart/form-data request
+// body. Calling Done returns to the request.
+type MultipartBuilder interface {
+	// Field adds a form field using the given name and value.
+	Field(string, string) MultipartBuilder
+	// File adds a file using the given field name and file name, reading its
+	// content from the given reader when the request is sent.
+	File(string, string, io.Reader) MultipartBuilder
+	// Done returns the request the body belongs to.
+	Done() Rekwest
+}
+
+type multipartPart struct {
+	field, filename, value string
+	content                io.Reader
+}
+
+type multipartBuilder struct {
+	r     *request
+	parts []multipartPart
+}
+
+func (r *request) Multipart() MultipartBuilder {
+	r.Body(nil)
+	r.multipart = &multipartBuilder{r: r}
+	return r.multipart
+}
+
+func (b *multipartBuilder) Field(name, value string) MultipartBuilder {
+	b.parts = append(b.parts, multipartPart{field: name, value: value})
+	return b
+}
+
+func (b *multipartBuilder) File(field, filename string, content io.Reader) MultipartBuilder {
+	b.parts = append(b.parts, multipartPart{field: field, filename: filename, content: content})
+	return b
+}
+
+func (b *multipartBuilder) Done() Rekwest {
+	return b.r
+}
+
+// write writes all parts using the given writer.
+func (b *multipartBuilder) write(w *multipart.Writer) error {
+	for _, part := range b.parts {
+		if part.content == nil {
+			if err := w.WriteField(part.field, part.value); err != nil {
+				return err
+			}
+			continue
+		}
+		fw, err := w.CreateFormFile(part.field, part.filename)
+		if err != nil {
+			return err
+		}
+		content := &contentReader{Reader: part.content}
+		if _, err := io.Copy(fw, content); err != nil {
+			if content.err != nil {
+				return &partError{filename: part.filename, err: content.err}
+			}
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// contentReader records the error reading the content of a part, telling it
+// apart from errors writing to the request body.
+type contentReader struct {
+	io.Reader
+	err error
+}
+
+func (c *contentReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// partError is the error reading the content of a part. It is caused by the
+// given reader rather than by sending the request, so it is reported as a
+// build error.
+type partError struct {
+	filename string
+	err      error
+}
+
+func (e *partError) Error() string {
+	return fmt.Sprintf("could not copy file %s: %v", e.filename, e.err)
+}
+
+func (e *partError) Unwrap() error {
+	return e.err
+}
+
+// newMultipartRequest builds a request streaming the multipart body through
+// a pipe, so files are never buffered entirely.
+func (r *request) newMultipartRequest() (*http.Request, error) {
+	if r.compressMultipart {
+		return r.newCompressedMultipartRequest()
+	}
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	body := &multipartBody{
+		PipeReader: pr,
+	}
+	body.start = func() {
+		go func() {
+			err := r.multipart.write(w)
+			if partErr, ok := err.(*partError); ok {
+				body.mu.Lock()
+				body.err = partErr
+				body.mu.Unlock()
+			}
+			pw.CloseWithError(err)
+		}()
+	}
+	req, err := r.buildRequest(r.method, r.url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req, nil
+}
+
+// newCompressedMultipartRequest builds a request sending the gzipped
+// multipart body, which needs to be buffered entirely for compressing it.
+func (r *request) newCompressedMultipartRequest() (*http.Request, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := r.multipart.write(w); err != nil {
+		return nil, err
+	}
+	compressed, err := gzipData(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	req, err := r.buildRequest(r.method, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Content-Encoding", "gzip")
+	setReplayableBody(req, len(compressed), func() io.ReadCloser {
+		return ioutil.NopCloser(bytes.NewReader(compressed))
+	})
+	return req, nil
+}
+
+// multipartBody starts writing the parts once it is read for the first
+// time, so no writer is left behind for requests that are never sent.
+type multipartBody struct {
+	*io.PipeReader
+	once  sync.Once
+	start func()
+
+	mu  sync.Mutex
+	err *partError
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.once.Do(b.start)
+	return b.PipeReader.Read(p)
+}
+
+// sourceErr returns the error reading the content of a part, if any.
+func (b *multipartBody) sourceErr() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		return nil
+	}
+	return b.err
+}
@@ -0,0 +1,150 @@
+package rekwest
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRekwest_Multipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("picture")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := ioutil.ReadAll(file)
+		w.Write([]byte(r.FormValue("animal") + " " + header.Filename + " " + string(content)))
+	}))
+	defer ts.Close()
+
+	t.Run("fields and files", func(t *testing.T) {
+		var data []byte
+		err := New(ts.URL).
+			Method(http.MethodPost).
+			Multipart().
+			Field("animal", "platypus").
+			File("picture", "platypus.png", strings.NewReader("not really a png")).
+			Done().
+			Do(&data)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := "platypus platypus.png not really a png"; string(data) != expected {
+			t.Errorf("Expected %q, got %q", expected, string(data))
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		readErr := errors.New("disk on fire")
+		err := New(ts.URL).
+			Method(http.MethodPost).
+			Multipart().
+			File("picture", "platypus.png", io.MultiReader(strings.NewReader("not really"), &failingReader{readErr})).
+			Done().
+			Do()
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || !errors.Is(err, readErr) {
+			t.Errorf("Expected MultiError containing the read error, got %v", err)
+		}
+		if len(multiErr.BuildErrors()) != 1 || len(multiErr.TransportErrors()) != 0 {
+			t.Errorf("Expected read error to be reported as build error, got %v", multiErr.Errors)
+		}
+		if expected := "could not copy file platypus.png: disk on fire"; err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got %v", expected, err)
+		}
+	})
+
+	t.Run("replaced body", func(t *testing.T) {
+		err := New(ts.URL).
+			Method(http.MethodPost).
+			Multipart().
+			Field("animal", "platypus").
+			Done().
+			BytesBody([]byte("platypus")).
+			Do()
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadRequest {
+			t.Errorf("Expected multipart body to be replaced, got %v", err)
+		}
+	})
+}
+
+type failingReader struct {
+	err error
+}
+
+func (f *failingReader) Read([]byte) (int, error) {
+	return 0, f.err
+}
+
+func TestRekwest_CompressMultipart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "expected gzipped body", http.StatusBadRequest)
+			return
+		}
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = body
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("picture")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := ioutil.ReadAll(file)
+		w.Write([]byte(r.FormValue("animal") + " " + header.Filename + " " + string(content)))
+	}))
+	defer ts.Close()
+
+	t.Run("fields and files", func(t *testing.T) {
+		var data []byte
+		err := New(ts.URL).
+			Method(http.MethodPost).
+			Multipart().
+			Field("animal", "platypus").
+			File("picture", "platypus.png", strings.NewReader(strings.Repeat("not really a png ", 64))).
+			Done().
+			CompressMultipart().
+			Do(&data)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := "platypus platypus.png " + strings.Repeat("not really a png ", 64); string(data) != expected {
+			t.Errorf("Expected %q, got %q", expected, string(data))
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		readErr := errors.New("disk on fire")
+		err := New(ts.URL).
+			Method(http.MethodPost).
+			Multipart().
+			File("picture", "platypus.png", &failingReader{readErr}).
+			Done().
+			CompressMultipart().
+			Do()
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || !errors.Is(err, readErr) || len(multiErr.BuildErrors()) != 1 {
+			t.Errorf("Expected read error to be reported as build error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package rekwest
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity up to which buffers are returned to the
+// pool, so single large payloads do not stay in memory.
+const maxPooledBufferSize = 1 << 16
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// pooledBody is a request body backed by a pooled buffer. The buffer is
+// returned to the pool once the owning request and all readers handed out
+// to the transport have released it.
+type pooledBody struct {
+	buf  *bytes.Buffer
+	mu   sync.Mutex
+	refs int
+}
+
+func newPooledBody(data interface{}, encode func(*bytes.Buffer, interface{}) error) (*pooledBody, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := encode(buf, data); err != nil {
+		bufferPool.Put(buf)
+		return nil, err
+	}
+	return &pooledBody{buf: buf, refs: 1}, nil
+}
+
+// reader returns a new reader for the body's content, which the transport
+// is expected to close when being done with it.
+func (p *pooledBody) reader() io.ReadCloser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refs++
+	return &pooledReader{Reader: bytes.NewReader(p.buf.Bytes()), body: p}
+}
+
+func (p *pooledBody) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refs--
+	if p.refs == 0 && p.buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(p.buf)
+	}
+}
+
+type pooledReader struct {
+	*bytes.Reader
+	body *pooledBody
+	once sync.Once
+}
+
+func (p *pooledReader) Close() error {
+	p.once.Do(p.body.release)
+	return nil
+}
@@ -0,0 +1,55 @@
+package rekwest
+
+import (
+	"context"
+	"net/http"
+)
+
+// Propagator injects tracing information found in the context of a request
+// into its headers, e.g. for propagating traces across services.
+type Propagator interface {
+	Inject(context.Context, http.Header)
+}
+
+func (r *request) Propagate(p Propagator) Rekwest {
+	r.propagators = append(r.propagators, p)
+	return r
+}
+
+// B3 identifies a span of a trace using Zipkin's B3 propagation format.
+type B3 struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Sampled      bool
+}
+
+type b3Key struct{}
+
+// ContextWithB3 returns a context carrying the given B3 span, which is
+// read by B3Propagator.
+func ContextWithB3(ctx context.Context, span B3) context.Context {
+	return context.WithValue(ctx, b3Key{}, span)
+}
+
+// B3Propagator sets the X-B3-TraceId, X-B3-SpanId, X-B3-ParentSpanId and
+// X-B3-Sampled headers from the span added to the context using ContextWithB3.
+type B3Propagator struct{}
+
+// Inject implements Propagator.
+func (B3Propagator) Inject(ctx context.Context, header http.Header) {
+	span, ok := ctx.Value(b3Key{}).(B3)
+	if !ok || span.TraceID == "" || span.SpanID == "" {
+		return
+	}
+	header.Set("X-B3-TraceId", span.TraceID)
+	header.Set("X-B3-SpanId", span.SpanID)
+	if span.ParentSpanID != "" {
+		header.Set("X-B3-ParentSpanId", span.ParentSpanID)
+	}
+	if span.Sampled {
+		header.Set("X-B3-Sampled", "1")
+	} else {
+		header.Set("X-B3-Sampled", "0")
+	}
+}
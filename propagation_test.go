@@ -0,0 +1,70 @@
+package rekwest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRekwest_PropagateB3(t *testing.T) {
+	var received http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected map[string]string
+	}{
+		{
+			"sampled",
+			ContextWithB3(context.Background(), B3{
+				TraceID:      "463ac35c9f6413ad48485a3953bb6124",
+				SpanID:       "a2fb4a1d1a96d312",
+				ParentSpanID: "0020000000000001",
+				Sampled:      true,
+			}),
+			map[string]string{
+				"X-B3-Traceid":      "463ac35c9f6413ad48485a3953bb6124",
+				"X-B3-Spanid":       "a2fb4a1d1a96d312",
+				"X-B3-Parentspanid": "0020000000000001",
+				"X-B3-Sampled":      "1",
+			},
+		},
+		{
+			"not sampled",
+			ContextWithB3(context.Background(), B3{TraceID: "48485a3953bb6124", SpanID: "a2fb4a1d1a96d312"}),
+			map[string]string{
+				"X-B3-Traceid": "48485a3953bb6124",
+				"X-B3-Spanid":  "a2fb4a1d1a96d312",
+				"X-B3-Sampled": "0",
+			},
+		},
+		{
+			"no span",
+			context.Background(),
+			map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := New(ts.URL).Context(test.ctx).Propagate(B3Propagator{}).Do(); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			b3 := map[string]string{}
+			for key := range received {
+				if strings.HasPrefix(key, "X-B3-") {
+					b3[key] = received.Get(key)
+				}
+			}
+			if !reflect.DeepEqual(test.expected, b3) {
+				t.Errorf("Expected headers %v, got %v", test.expected, b3)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package rekwest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ContentRange describes the part of a resource contained in a response
+// with status 206 Partial Content.
+type ContentRange struct {
+	// Start and End are the positions of the first and last byte of the range.
+	Start, End int64
+	// Size is the complete length of the resource, or -1 in case it is unknown.
+	Size int64
+}
+
+func (r *request) Range(start, end int64) Rekwest {
+	if end < 0 {
+		r.headers(1).Set("Range", fmt.Sprintf("bytes=%d-", start))
+		return r
+	}
+	r.headers(1).Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	return r
+}
+
+func (r *request) ContentRange() (ContentRange, bool) {
+	if r.response == nil {
+		return ContentRange{}, false
+	}
+	return parseContentRange(r.response.Header.Get("Content-Range"))
+}
+
+// parseContentRange parses a Content-Range header value of the form
+// `bytes start-end/size`, where size may be `*`.
+func parseContentRange(value string) (ContentRange, bool) {
+	if !strings.HasPrefix(value, "bytes ") {
+		return ContentRange{}, false
+	}
+	value = strings.TrimPrefix(value, "bytes ")
+	i := strings.IndexByte(value, '/')
+	j := strings.IndexByte(value, '-')
+	if i < 0 || j < 0 || j > i {
+		return ContentRange{}, false
+	}
+	start, err := strconv.ParseInt(value[:j], 10, 64)
+	if err != nil {
+		return ContentRange{}, false
+	}
+	end, err := strconv.ParseInt(value[j+1:i], 10, 64)
+	if err != nil || end < start {
+		return ContentRange{}, false
+	}
+	size := int64(-1)
+	if s := value[i+1:]; s != "*" {
+		if size, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return ContentRange{}, false
+		}
+	}
+	return ContentRange{start, end, size}, true
+}
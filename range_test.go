@@ -0,0 +1,88 @@
+package rekwest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// statusTransport records the status of the last response it received.
+type statusTransport struct {
+	status *int
+}
+
+func (s statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		*s.status = res.StatusCode
+	}
+	return res, err
+}
+
+func TestRekwest_Range(t *testing.T) {
+	content := []byte("the platypus is a semiaquatic, egg-laying mammal")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "animal.txt", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		start, end    int64
+		expectedBody  string
+		expectedRange ContentRange
+	}{
+		{"closed", 4, 11, "platypus", ContentRange{4, 11, int64(len(content))}},
+		{"open", 35, -1, "laying mammal", ContentRange{35, int64(len(content) - 1), int64(len(content))}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var status int
+			var data []byte
+			r := New(ts.URL).
+				Client(&http.Client{Transport: statusTransport{&status}}).
+				Range(test.start, test.end)
+			if err := r.Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if status != http.StatusPartialContent {
+				t.Errorf("Expected status %d, got %d", http.StatusPartialContent, status)
+			}
+			if string(data) != test.expectedBody {
+				t.Errorf("Expected body %q, got %q", test.expectedBody, string(data))
+			}
+			contentRange, ok := r.ContentRange()
+			if !ok {
+				t.Fatal("Expected a content range")
+			}
+			if contentRange != test.expectedRange {
+				t.Errorf("Expected range %v, got %v", test.expectedRange, contentRange)
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected ContentRange
+		ok       bool
+	}{
+		{"bytes 0-99/1000", ContentRange{0, 99, 1000}, true},
+		{"bytes 100-199/*", ContentRange{100, 199, -1}, true},
+		{"bytes */1000", ContentRange{}, false},
+		{"bytes 200-100/1000", ContentRange{}, false},
+		{"items 0-99/1000", ContentRange{}, false},
+		{"", ContentRange{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			contentRange, ok := parseContentRange(test.value)
+			if ok != test.ok || contentRange != test.expected {
+				t.Errorf("Expected %v %v, got %v %v", test.expected, test.ok, contentRange, ok)
+			}
+		})
+	}
+}
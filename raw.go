@@ -0,0 +1,28 @@
+package rekwest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (r *request) Raw() (res *http.Response, err error) {
+	defer func() {
+		r.finish(err)
+	}()
+
+	if !r.OK() {
+		return nil, fmt.Errorf("could not perform request: %w", r.multiErr)
+	}
+
+	timeout, cancel := r.timeoutContext()
+	res, err = r.perform(timeout, r.newRequest)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.response = res
+	// the timeout keeps applying while the caller reads the body, so it is
+	// released once the body is closed
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package rekwest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRekwest_Raw(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"animal":`))
+		if r.URL.Query().Get("slow") != "" {
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte(`"platypus"}`))
+		w.Header().Set("X-Checksum", "abc")
+	}))
+	defer ts.Close()
+
+	t.Run("ok", func(t *testing.T) {
+		res, err := New(ts.URL).BearerToken("secret").Raw()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(b) != `{"animal":"platypus"}` {
+			t.Errorf("Expected raw body, got %q", string(b))
+		}
+		if trailer := res.Trailer.Get("X-Checksum"); trailer != "abc" {
+			t.Errorf("Expected trailer to be received, got %q", trailer)
+		}
+	})
+	t.Run("error status", func(t *testing.T) {
+		res, err := New(ts.URL).Raw()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", res.StatusCode)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		res, err := New(ts.URL + "?slow=1").BearerToken("secret").Timeout(100 * time.Millisecond).Raw()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer res.Body.Close()
+		if _, err := ioutil.ReadAll(res.Body); err == nil {
+			t.Error("Expected timeout to apply to reading the body")
+		}
+	})
+	t.Run("build error", func(t *testing.T) {
+		_, err := New(ts.URL).JSONBody(func() {}).Raw()
+		if err == nil || !strings.Contains(err.Error(), "could not perform request") {
+			t.Errorf("Expected build error, got %v", err)
+		}
+	})
+}
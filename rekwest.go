@@ -2,74 +2,529 @@ package rekwest
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultResponseFormat is the response format used by requests created
+// using New. It can be changed once at startup, e.g. to ResponseFormatJSON
+// for services exclusively talking JSON. Calling ResponseFormat on a request
+// still overrides it.
+var DefaultResponseFormat = ResponseFormatContentType
+
+// DefaultQuery holds query parameters added to the URL of requests created
+// using New, e.g. an API version or a tenant id. It can be changed once at
+// startup. Parameters set using Query or contained in the URL replace the
+// default values of the same key.
+var DefaultQuery = url.Values{}
+
 // New creates a new Rekwest that will perform requests against the given URL.
-// It defaults to performing GET requests and no body, expecting JSON to be sent
-// in return.
+// It defaults to performing GET requests and no body, inferring the format of
+// the response from its content type unless DefaultResponseFormat is changed.
 func New(url string) Rekwest {
-	return &request{
+	r := &request{
 		client:         http.DefaultClient,
 		url:            url,
 		method:         http.MethodGet,
-		header:         http.Header{},
 		context:        context.Background(),
 		responseFormat: ResponseFormatContentType,
 	}
+	if DefaultResponseFormat != ResponseFormatContentType {
+		r.ResponseFormat(DefaultResponseFormat)
+	}
+	if len(DefaultQuery) != 0 {
+		r.defaultQuery = cloneValues(DefaultQuery)
+	}
+	return r
+}
+
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, v := range values {
+		clone[key] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+// Get creates a new Rekwest performing a GET request against the given URL.
+func Get(url string) Rekwest {
+	return New(url).Method(http.MethodGet)
+}
+
+// Head creates a new Rekwest performing a HEAD request against the given URL.
+func Head(url string) Rekwest {
+	return New(url).Method(http.MethodHead)
+}
+
+// Post creates a new Rekwest performing a POST request against the given URL.
+func Post(url string) Rekwest {
+	return New(url).Method(http.MethodPost)
+}
+
+// Put creates a new Rekwest performing a PUT request against the given URL.
+func Put(url string) Rekwest {
+	return New(url).Method(http.MethodPut)
+}
+
+// Patch creates a new Rekwest performing a PATCH request against the given URL.
+func Patch(url string) Rekwest {
+	return New(url).Method(http.MethodPatch)
+}
+
+// Delete creates a new Rekwest performing a DELETE request against the given URL.
+func Delete(url string) Rekwest {
+	return New(url).Method(http.MethodDelete)
+}
+
+// Must panics in case the given error is not nil. It is meant for reducing
+// boilerplate in scripts and throwaway tooling and should never be used
+// in libraries.
+func Must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// MustDo performs the given request, decoding the response onto the given
+// targets, and panics in case of an error. The same caveats as for Must apply.
+func MustDo(r Rekwest, targets ...interface{}) {
+	Must(r.Do(targets...))
+}
+
+// inFlight is the number of requests that are being sent.
+var inFlight int64
+
+// InFlight returns the number of requests that are currently being sent
+// across all requests, e.g. for applying backpressure or adapting the
+// concurrency of callers. It counts requests sent by all methods, e.g. Do,
+// Raw, PollUntil, DownloadResumable and Upgrade, until their response has
+// been received or they have failed, including retries.
+func InFlight() int {
+	return int(atomic.LoadInt64(&inFlight))
 }
 
 // Rekwest is a chainable interface for building and performing HTTP requests.
 type Rekwest interface {
-	// Method sets the request Method.
+	// Method sets the request Method. Besides the standard methods, extension
+	// methods like PROPFIND are accepted as long as they are valid tokens.
 	Method(string) Rekwest
 	// Body sets the request body.
 	Body(io.Reader) Rekwest
 	// bytesBody uses the given byte array as the request body.
 	BytesBody([]byte) Rekwest
+	// ChannelBody streams all byte slices received from the given channel as the
+	// request body. The body ends when the channel is closed. The producer can
+	// signal a failure by sending an error on the given error channel, which
+	// may be nil, aborting the request with a build error.
+	ChannelBody(<-chan []byte, <-chan error) Rekwest
+	// BodyProvider ensures the request body is streamed from a fresh reader
+	// returned by the given function for each attempt, so requests can be
+	// retried or redirected without buffering the body in memory.
+	BodyProvider(func() (io.ReadCloser, error)) Rekwest
+	// ResetBody clears the request body along with the content type implied
+	// by it, so the request can be reused with a different body. Headers set
+	// explicitly are kept.
+	ResetBody() Rekwest
 	// MarshalBody uses the given marshal func to marshal the given data into the
 	// request body. For JSON and XML payloads, you can use the JSONBody and
-	// XMLBody methods.
+	// XMLBody methods. The returned bytes are kept, so the request can be
+	// sent repeatedly.
 	MarshalBody(interface{}, func(interface{}) ([]byte, error)) Rekwest
+	// CompressRequestOver ensures in memory request bodies larger than the
+	// given number of bytes are gzipped and sent using Content-Encoding: gzip.
+	// Smaller bodies and bodies passed as an io.Reader are sent as is.
+	CompressRequestOver(int) Rekwest
+	// GzipBody ensures non-empty in memory request bodies are gzipped and sent
+	// using Content-Encoding: gzip regardless of their size.
+	GzipBody() Rekwest
+	// CompressMultipart ensures the multipart body is gzipped and sent using
+	// Content-Encoding: gzip. The body is buffered entirely for compressing
+	// it instead of being streamed, so only use it with servers supporting
+	// compressed requests.
+	CompressMultipart() Rekwest
+	// FormatBody marshals the given data using the encoder registered for
+	// the given media type using RegisterFormat and sets the Content-Type
+	// header accordingly.
+	FormatBody(string, interface{}) Rekwest
 	// JSONBody marshals the given data into JSON and uses it as the request body.
+	// Content-Type application/json is sent unless set explicitly using Header.
+	// The data is encoded into a pooled buffer that is released once `Do`
+	// returns, so calling `Do` again fails unless the body is set again.
 	JSONBody(interface{}) Rekwest
+	// JSONBodyTagged marshals the given data into JSON and uses it as the
+	// request body. Struct fields are named after the given tag key
+	// instead of the `json` tag, while values implementing json.Marshaler or
+	// encoding.TextMarshaler marshal themselves. Cyclic data results in an
+	// error. Like for JSONBody, the body is released once `Do` returns.
+	JSONBodyTagged(interface{}, string) Rekwest
 	// XMLBody marshals the given data into XML and uses it as the request body.
+	// Content-Type application/xml is sent unless set explicitly using Header.
+	// The pooled buffer holding the body is released once `Do` returns, so the
+	// body needs to be set again before calling `Do` another time.
 	XMLBody(interface{}) Rekwest
-	// Header sets the request header of the given key to the given value.
+	// Multipart returns a builder for a multipart/form-data request body,
+	// which is streamed when the request is sent unless using
+	// `CompressMultipart`. The Content-Type header
+	// including the boundary is set accordingly. Errors reading files make
+	// `Do` fail.
+	Multipart() MultipartBuilder
+	// FormBody encodes the given values and uses them as the request body
+	// using Content-Type application/x-www-form-urlencoded.
+	FormBody(url.Values) Rekwest
+	// FormStruct encodes the exported fields of the given struct like
+	// `QueryStruct` and uses them as the request body using Content-Type
+	// application/x-www-form-urlencoded. Names are given in `form` struct
+	// tags, falling back to `url` tags for fields without one.
+	FormStruct(interface{}) Rekwest
+	// Header adds the given value to the request header of the given key.
+	// Calling it repeatedly using the same key sends all values.
 	Header(string, string) Rekwest
 	// Headers sets the request headers for all key/value pairs in the
 	// given map.
 	Headers(map[string]string) Rekwest
+	// SetHeaders merges the given header into the request headers, keeping
+	// all values of keys having multiple values.
+	SetHeaders(http.Header) Rekwest
+	// Propagate ensures the given propagator injects tracing information from
+	// the request's context into the request headers, e.g. B3Propagator.
+	Propagate(Propagator) Rekwest
 	// BasicAuth ensures the given basic auth credentials will be used
 	// when performing the request.
 	BasicAuth(string, string) Rekwest
 	// BearerToken ensures Authorization headers with the given bearer token
 	// will be sent.
 	BearerToken(string) Rekwest
+	// PreRequest ensures the given hook is called with the built request
+	// right before it is sent, e.g. for enforcing policies. Hooks run in the
+	// order they were added, and the first one returning a non-nil error
+	// aborts the request, making `Do` return an error wrapping it.
+	PreRequest(func(*http.Request) error) Rekwest
+	// Cookie ensures the given cookie is sent with the request. Only its name
+	// and value are sent, which are sanitized according to the rules of
+	// net/http.
+	Cookie(*http.Cookie) Rekwest
+	// Cookies ensures all of the given cookies are sent with the request.
+	Cookies(...*http.Cookie) Rekwest
+	// UserAgent sets the User-Agent header, replacing the default agent of
+	// the Go HTTP client.
+	UserAgent(string) Rekwest
+	// AcceptCharset sets the Accept-Charset header, assigning decreasing
+	// quality values to the given charsets in order of preference. JSON and XML
+	// responses using ISO-8859-1 are decoded into UTF-8 automatically.
+	AcceptCharset(...string) Rekwest
+	// AcceptLanguage sets the Accept-Language header, assigning decreasing
+	// quality values to the given languages in order of preference.
+	AcceptLanguage(...string) Rekwest
+	// Priority hints the server about the priority of the request using the
+	// given HTTP/2 style weight between 1 and 256. As the standard library does
+	// not allow setting stream priorities, the weight is sent as the urgency of
+	// an RFC 9218 Priority header, where higher weights map to higher
+	// urgency. Servers not supporting the header will simply ignore it.
+	Priority(int) Rekwest
+	// QueryStruct adds the exported fields of the given struct to the query
+	// of the request's URL, using the names given in `url` struct tags.
+	// Fields tagged `omitempty` are skipped in case of zero values and
+	// slices result in repeated keys. Fields of unsupported kinds result in
+	// an error.
+	QueryStruct(interface{}) Rekwest
+	// DefaultScheme sets the scheme used in case the request's URL is
+	// protocol-relative, e.g. `//www.example.com/api`. It defaults to https.
+	DefaultScheme(string) Rekwest
+	// Path appends the given segments to the path of the request's URL,
+	// keeping its query. Slashes between segments are normalized, while
+	// characters like `?` are escaped. Segments containing invalid escapes or
+	// dot segments like `..`, which could escape the existing path, result in
+	// an error.
+	Path(...string) Rekwest
+	// Query adds the given query parameter to the request's URL. Parameters
+	// are escaped and merged with the query already present in the URL, so
+	// calling Query with the same key repeatedly adds multiple values. Values
+	// given for a key of DefaultQuery replace its default values.
+	Query(string, string) Rekwest
+	// QueryValues adds all of the given values to the request's URL using
+	// the given key. An empty slice leaves the query unchanged.
+	QueryValues(string, []string) Rekwest
+	// IfUnmodifiedSince sets the If-Unmodified-Since header so the request
+	// fails in case the resource has been modified after the given time. Such
+	// failures can be detected using `errors.Is(err, ErrPreconditionFailed)`.
+	IfUnmodifiedSince(time.Time) Rekwest
+	// RequestID sets the given header to a randomly generated ID identifying
+	// the request, e.g. X-Request-Id.
+	RequestID(string) Rekwest
+	// VerifyRequestIDEcho ensures the response echoes the ID set using
+	// `RequestID` in the given header. Otherwise `Do` fails with an error
+	// matching `ErrRequestIDMismatch`, which can reveal proxies mangling
+	// requests.
+	VerifyRequestIDEcho(string) Rekwest
+	// Range sets the Range header to request the bytes from start to end,
+	// both inclusive. A negative end requests all bytes following start.
+	// Servers supporting ranges respond using status 206 Partial Content.
+	Range(int64, int64) Rekwest
+	// Prefer sets a Prefer header using the given value, e.g. to ask for
+	// asynchronous processing using `respond-async`.
+	Prefer(string) Rekwest
 	// Context adds a context to the request. In case the context hits the
 	// cancellation deadline before the request can be performed, `Do` will return
 	// the context's error.
 	Context(context.Context) Rekwest
+	// WithValue derives a new context from the request's context carrying the
+	// given key and value. The context is passed on to the *http.Request, so it
+	// can be read by the client's transport.
+	WithValue(interface{}, interface{}) Rekwest
 	// ResponseFormat sets the expected response format. It can be set to
 	// ResponseFormatJSON or ResponseFormatXML.
 	ResponseFormat(ResponseFormat) Rekwest
+	// DecodeBufferSize ensures JSON and XML responses are read through a
+	// buffer of the given size when decoding, which can improve throughput
+	// for large payloads. By default, no additional buffering happens.
+	DecodeBufferSize(int) Rekwest
+	// Unwrap ensures JSON responses are expected to be wrapped in an envelope
+	// object. Only the value found under the given key will be decoded onto
+	// the targets passed to `Do`.
+	Unwrap(string) Rekwest
+	// ErrorFormatter sets a func that creates the error returned for responses
+	// with an error status from the status and the response body. In case it
+	// returns nil or the body cannot be read, the default error is returned.
+	ErrorFormatter(func(int, []byte) error) Rekwest
+	// MaxResponseBytes limits the number of bytes read from the response body.
+	// Reading a larger body fails with an error reporting the limit and the
+	// number of bytes read.
+	MaxResponseBytes(int64) Rekwest
+	// MaxResponseHeaders limits the number of header fields a response may
+	// have, counting each value of a repeated header. Receiving more fails
+	// with an error before the response is decoded.
+	MaxResponseHeaders(int) Rekwest
+	// VerifyDigest ensures the response body is verified against the digests
+	// sent in Content-MD5 or Digest response headers. This requires buffering
+	// the response body. Responses without digest headers are not verified.
+	VerifyDigest() Rekwest
+	// Validate adds a func that validates the buffered response body before it
+	// is decoded, e.g. against a JSON schema using a library of your choice.
+	// A non-nil error makes `Do` fail. Multiple validators run in order and
+	// are bounded by the request's timeout and context.
+	Validate(func([]byte) error) Rekwest
 	// Timeout sets a timeout value for performing the request. The countdown
-	// starts when calling `Do`.
+	// starts when calling `Do`. In case the request's context has a deadline
+	// as well, whichever is reached first applies. Both are merged into the
+	// context the request is sent with, so in-flight I/O is canceled.
 	Timeout(time.Duration) Rekwest
+	// DecodeTimeout bounds reading and decoding the response body, starting
+	// once the response headers have been received. It applies in addition
+	// to the request's timeout and context.
+	DecodeTimeout(time.Duration) Rekwest
+	// TimeoutFraction ensures the request only uses the given fraction of the
+	// time remaining until the deadline of the request's context. The
+	// fraction is computed when calling `Do` and clamped to values between 0
+	// and 1, where 0 disables the behavior. In case a shorter timeout is set
+	// using `Timeout`, it takes precedence.
+	TimeoutFraction(float64) Rekwest
+	// EffectiveDeadline returns the earlier of the deadline of the request's
+	// context and the time the timeout would be reached when calling `Do`
+	// now. It reports false in case neither is set.
+	EffectiveDeadline() (time.Time, bool)
+	// ResponseHeaderTimeout limits the time to wait for the response headers
+	// after the request has been written. It is applied to a clone of the
+	// client's transport, which therefore needs to be an *http.Transport.
+	ResponseHeaderTimeout(time.Duration) Rekwest
+	// Resolver ensures the given resolver is used for looking up host names
+	// when dialing. It replaces the dialer of a clone of the client's transport,
+	// which therefore needs to be an *http.Transport.
+	Resolver(*net.Resolver) Rekwest
+	// MinTLSVersion sets the minimum TLS version accepted when connecting to
+	// the server, e.g. tls.VersionTLS12. It is applied to a clone of the
+	// client's transport, which therefore needs to be an *http.Transport.
+	MinTLSVersion(uint16) Rekwest
+	// TLSServerName sets the server name sent using SNI and expected in the
+	// server's certificate, e.g. when connecting to an IP address. It is
+	// applied to a clone of the client's transport, which therefore needs
+	// to be an *http.Transport.
+	TLSServerName(string) Rekwest
+	// SocketDeadlines ensures each read from and write to the underlying
+	// connection has to complete within the given durations, which protects
+	// against half-open connections. A zero value disables the respective
+	// deadline. It wraps the dialer of a clone of the client's transport,
+	// which therefore needs to be an *http.Transport.
+	SocketDeadlines(time.Duration, time.Duration) Rekwest
+	// Trace opts into measuring the time spent in the phases of building and
+	// performing the request. The given Timing is populated when `Do` returns.
+	Trace(*Timing) Rekwest
+	// DebugOnError ensures the error, a curl command reproducing the request
+	// and the measured timings are written to the given writer in case `Do`
+	// returns an error. Credentials are redacted from the output.
+	DebugOnError(io.Writer) Rekwest
+	// HARRecorder ensures the request and its response are appended as an
+	// entry to the given HTTP Archive (HAR) log once `Do` returns, so that
+	// multiple requests can be recorded into the same log. Compressed
+	// response bodies are recorded decompressed. Credentials are redacted.
+	HARRecorder(*HARLog) Rekwest
+	// CircuitBreaker ensures the given breaker is consulted before sending the
+	// request. In case it does not allow the request, `ErrCircuitOpen` is
+	// returned without performing it. Otherwise the outcome is recorded, where
+	// transport errors, timeouts and 5xx responses count as failures.
+	CircuitBreaker(Breaker) Rekwest
+	// Retry ensures the request is retried up to the given number of times
+	// in case of transport errors or 5xx responses. Streamed bodies are
+	// buffered in memory so each attempt sends all of it, except for multipart
+	// bodies which are never retried. Use BodyProvider to avoid buffering.
+	// The timeout applies to all attempts, so no retry is started in case it
+	// could not begin before the deadline.
+	Retry(attempts int) Rekwest
+	// RetryBackoff ensures retries wait for the given base duration, which is
+	// multiplied by factor for each subsequent retry. The delays are jittered
+	// and waiting is aborted once the timeout or the request's context is done.
+	RetryBackoff(base time.Duration, factor float64) Rekwest
+	// RetryOnBody ensures 2xx responses are retried in case the given function
+	// returns true for their body, e.g. when an API signals a transient failure
+	// in the payload. The body is buffered for inspection.
+	RetryOnBody(func(body []byte) bool) Rekwest
+	// RetryOn ensures responses with the given status codes are retried
+	// instead of 5xx responses. Transport errors are still retried. In case a
+	// 429 or 503 response has a Retry-After header, it takes precedence over
+	// the backoff.
+	RetryOn(codes ...int) Rekwest
+	// RetryOnErrors ensures attempts failing with an error matching any of the
+	// given errors according to errors.Is are retried, e.g. io.ErrUnexpectedEOF
+	// in case a proxy cuts off responses. The body of responses that are not
+	// retried otherwise is buffered, so errors reading it are detected.
+	RetryOnErrors(errs ...error) Rekwest
+	// RetryIf ensures the given function decides whether the outcome of an
+	// attempt is retried, replacing the default behavior and `RetryOn`. The
+	// response is nil in case the error is not.
+	RetryIf(func(*http.Response, error) bool) Rekwest
 	// Client ensures the given *http.Client will be used for performing the
 	// request when calling `Do`.
 	Client(*http.Client) Rekwest
+	// CookieJar ensures the given jar stores cookies set by responses and
+	// adds matching cookies to the request when calling `Do`. The jar is
+	// installed on a copy of the client, so a client set using `Client` is
+	// never mutated and keeps its jar for other requests. Pass the same jar
+	// to multiple requests to share a session between them.
+	CookieJar(http.CookieJar) Rekwest
+	// Replay ensures `Do` will not perform any request but handle a response
+	// with the given status, header and body instead. It is intended to be
+	// used for testing or replaying recorded responses offline.
+	Replay(int, http.Header, []byte) Rekwest
 	// Errors returns all errors that occurred when building the request.
 	Errors() []error
 	// OK returns true if no errors have been encountered when building the request.
 	OK() bool
+	// StrictBuild ensures errors encountered when building the request, e.g.
+	// failing to marshal a body, cause a panic right away instead of being
+	// returned by `Do`. Errors encountered before are reported immediately.
+	StrictBuild() Rekwest
+	// AcceptStatus ensures responses with the given status codes of 400 and
+	// above are not handled as errors, so their body is decoded into the
+	// targets passed to `Do` like for any other successful response.
+	AcceptStatus(codes ...int) Rekwest
+	// Into ensures the status, headers and a copy of the body of the response
+	// are stored in the given Response once the request has been performed.
+	// Its Target is decoded in addition to the targets passed to `Do`.
+	Into(*Response) Rekwest
+	// Raw performs the request like `Do` does, but returns the response
+	// without handling its status or decoding its body. The caller is
+	// responsible for closing the body. The request's timeout and context
+	// keep applying to reading the body.
+	Raw() (*http.Response, error)
 	// Do performs the request and returns possible errors.
-	// The response body will encoded onto the passed target if given.
+	// The response body will encoded onto the passed target if given. The
+	// body is buffered, so each of multiple targets receives all of it,
+	// decoded using the response format unless wrapped using AsFormat.
 	Do(...interface{}) error
+	// DoJSON marshals the given body into JSON, performs the request expecting
+	// a JSON response and decodes it onto the given target if not nil. Unless
+	// a method has been set explicitly, POST is used.
+	DoJSON(interface{}, interface{}) error
+	// PollUntil performs the request and keeps polling the URL given in the
+	// response's Location header using GET requests in the given interval until
+	// the done func returns true for a response. This response will then be
+	// encoded onto the passed target if given. In case done is nil, polling
+	// stops as soon as a response does not have status 202. The request's context
+	// and timeout apply to the entire polling cycle. Polling requests are sent
+	// to the Location as given, with the request's headers but without its
+	// query parameters and body.
+	PollUntil(interface{}, time.Duration, func(*http.Response) bool) error
+	// Upgrade performs the request asking the server to switch to the given
+	// protocol, e.g. `websocket`. In case the server responds with status 101,
+	// the upgraded connection is returned and needs to be closed by the caller.
+	// Protocol specific headers like Sec-WebSocket-Key have to be set using
+	// `Header` beforehand.
+	Upgrade(string) (net.Conn, *http.Response, error)
+	// DownloadResumable performs the request and writes the response body to
+	// the file at the given path. In case the file exists already, only the
+	// remaining bytes are requested using a Range header and appended to it.
+	// The validator of the resource is stored alongside the file while the
+	// download is incomplete and sent as If-Range, so that a changed resource
+	// replaces the file, as it does in case the server does not support
+	// ranges.
+	DownloadResumable(string) error
+	// StatusCode returns the status code of the response received when
+	// calling `Do`, including responses with an error status. It is only
+	// valid after `Do` has returned and 0 in case no response has been
+	// received.
+	StatusCode() int
+	// ResponseBody returns a copy of the body of the response received when
+	// calling `Do`. The body is buffered once and all targets are decoded
+	// from it. It is only valid after `Do` has returned and nil in case no
+	// body has been read.
+	ResponseBody() []byte
+	// ResponseHeaders returns a copy of the headers of the response received
+	// when calling `Do`, e.g. for reading pagination links or rate limits.
+	// It is only valid after `Do` has returned and nil in case no response
+	// has been received.
+	ResponseHeaders() http.Header
+	// ResponseCookies returns the cookies set by the response received when
+	// calling `Do` using Set-Cookie headers, independent of the client's
+	// cookie jar. It is only valid after `Do` has returned and nil in case no
+	// response has been received.
+	ResponseCookies() []*http.Cookie
+	// ContentRange returns the range sent in the Content-Range header of the
+	// response after calling `Do`. It reports false in case the header is
+	// missing or invalid.
+	ContentRange() (ContentRange, bool)
+}
+
+// Unmarshaler is implemented by targets that decode responses themselves.
+// When passed to `Do`, UnmarshalRekwest is called using the content type
+// and the body of the response instead of applying the response format.
+type Unmarshaler interface {
+	UnmarshalRekwest(contentType string, body []byte) error
+}
+
+// Breaker is a circuit breaker protecting against cascading failures, e.g.
+// a wrapper around a third party implementation.
+type Breaker interface {
+	// Allow reports whether a request may be sent.
+	Allow() bool
+	// RecordSuccess records a successful request.
+	RecordSuccess()
+	// RecordFailure records a failed request.
+	RecordFailure()
+}
+
+// ErrPreconditionFailed is matched by errors returned for responses with
+// status 412, e.g. when using conditional requests.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrCircuitOpen is returned when a request is not allowed by its Breaker.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Timing contains the durations measured for a request when using `Trace`.
+type Timing struct {
+	// Marshal is the time spent marshaling the request body.
+	Marshal time.Duration
+	// Headers is the time spent building the request and setting its headers.
+	Headers time.Duration
+	// Decode is the time spent decoding the response into the given targets.
+	Decode time.Duration
 }
 
 // ResponseFormat is a string describing the expected encoding
@@ -92,13 +547,30 @@ const (
 	targetFormatBytes targetFormat = "bytes"
 )
 
-func inferTargetFormat(contentType string) (targetFormat, error) {
-	m, _, err := mime.ParseMediaType(contentType)
+// inferTargetFormat infers the target format from the given content type,
+// consulting the formats registered using RegisterFormat.
+// In case the content type is missing or generic, the extension of the given
+// URL path is used as a fallback.
+func inferTargetFormat(contentType, urlPath string) (targetFormat, error) {
+	var m string
+	var err error
+	if contentType != "" {
+		m, _, err = mime.ParseMediaType(contentType)
+	}
+	if f, ok := lookupFormat(m); ok {
+		return f.target, err
+	}
 	switch m {
-	case "application/json":
-		return targetFormatJSON, err
-	case "text/xml", "application/xml":
-		return targetFormatXML, err
+	case "", "application/octet-stream", "binary/octet-stream":
+		if err == nil {
+			switch strings.ToLower(path.Ext(urlPath)) {
+			case ".json":
+				return targetFormatJSON, nil
+			case ".xml":
+				return targetFormatXML, nil
+			}
+		}
+		return targetFormatBytes, err
 	default:
 		return targetFormatBytes, err
 	}
@@ -109,13 +581,25 @@ const (
 	acceptXML       = "text/xml, application/xml"
 	contentTypeJSON = "application/json"
 	contentTypeXML  = "application/xml"
+	contentTypeForm = "application/x-www-form-urlencoded"
 )
 
-// MultiError is a basic wrapper around multiple errors.
+// MultiError is a basic wrapper around multiple errors. Each error is
+// categorized by the phase it occurred in, so callers can decide whether
+// e.g. retrying a request makes sense.
 type MultiError struct {
 	Errors []error
+	phases []errorPhase
 }
 
+type errorPhase int
+
+const (
+	phaseBuild errorPhase = iota
+	phaseTransport
+	phaseDecode
+)
+
 func (e MultiError) Error() string {
 	var collected []string
 	for _, err := range e.Errors {
@@ -124,8 +608,88 @@ func (e MultiError) Error() string {
 	return strings.Join(collected, ", ")
 }
 
-func (e *MultiError) append(errors ...error) {
+// Is reports whether any of the contained errors matches the given target,
+// so sentinel errors can be detected using errors.Is.
+func (e MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildErrors returns all errors that occurred when building the request.
+func (e MultiError) BuildErrors() []error {
+	return e.inPhase(phaseBuild)
+}
+
+// TransportErrors returns all errors that occurred when sending the request
+// and receiving the response.
+func (e MultiError) TransportErrors() []error {
+	return e.inPhase(phaseTransport)
+}
+
+// DNSErrors returns all transport errors that have been caused by failing
+// to resolve a host name. These usually indicate a misconfigured URL rather
+// than an unavailable upstream.
+func (e MultiError) DNSErrors() []error {
+	var matching []error
+	for _, err := range e.TransportErrors() {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			matching = append(matching, err)
+		}
+	}
+	return matching
+}
+
+// DecodeErrors returns all errors that occurred when decoding the response.
+func (e MultiError) DecodeErrors() []error {
+	return e.inPhase(phaseDecode)
+}
+
+func (e MultiError) inPhase(phase errorPhase) []error {
+	var matching []error
+	for i, err := range e.Errors {
+		if i < len(e.phases) && e.phases[i] == phase {
+			matching = append(matching, err)
+		}
+	}
+	return matching
+}
+
+func (e *MultiError) append(phase errorPhase, errors ...error) {
 	for _, err := range errors {
 		e.Errors = append(e.Errors, err)
+		e.phases = append(e.phases, phase)
 	}
 }
+
+// StatusError is returned by `Do` for responses with a status of 400 or
+// above, unless an ErrorFormatter returns a different error. It can be
+// inspected using errors.As.
+type StatusError struct {
+	// Code is the status code of the response.
+	Code int
+	// Body is the response body.
+	Body []byte
+
+	readErr error
+}
+
+func (e *StatusError) Error() string {
+	if e.readErr != nil {
+		return fmt.Sprintf("request failed with status %d: %s", e.Code, e.readErr)
+	}
+	return fmt.Sprintf("request failed with status %d: %s", e.Code, string(e.Body))
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrPreconditionFailed && e.Code == http.StatusPreconditionFailed
+}
+
+// Unwrap returns the error encountered when reading the response body, if any.
+func (e *StatusError) Unwrap() error {
+	return e.readErr
+}
@@ -0,0 +1,41 @@
+package rekwest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrRequestIDMismatch is matched by errors returned when a response does
+// not echo the ID of the request it belongs to.
+var ErrRequestIDMismatch = errors.New("request id mismatch")
+
+func (r *request) RequestID(header string) Rekwest {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		r.buildError(fmt.Errorf("could not generate request id: %w", err))
+		return r
+	}
+	r.requestID = hex.EncodeToString(b)
+	r.headers(1).Set(header, r.requestID)
+	return r
+}
+
+func (r *request) VerifyRequestIDEcho(header string) Rekwest {
+	r.requestIDEcho = header
+	return r
+}
+
+// verifyRequestIDEcho checks whether the given response echoes the ID of the
+// request in case this has been asked for.
+func (r *request) verifyRequestIDEcho(res *http.Response) error {
+	if r.requestIDEcho == "" || r.requestID == "" {
+		return nil
+	}
+	if echo := res.Header.Get(r.requestIDEcho); echo != r.requestID {
+		return fmt.Errorf("%w: sent %s, received %q in header %s", ErrRequestIDMismatch, r.requestID, echo, r.requestIDEcho)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package rekwest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRekwest_VerifyRequestIDEcho(t *testing.T) {
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Request-Id")
+		switch r.URL.Path {
+		case "/echo":
+			w.Header().Set("X-Request-Id", received)
+		case "/mangle":
+			w.Header().Set("X-Request-Id", "something-else")
+		}
+	}))
+	defer ts.Close()
+
+	t.Run("echo", func(t *testing.T) {
+		if err := New(ts.URL + "/echo").RequestID("X-Request-Id").VerifyRequestIDEcho("X-Request-Id").Do(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if len(received) != 32 {
+			t.Errorf("Expected generated request id, got %q", received)
+		}
+	})
+
+	for _, path := range []string{"/mangle", "/missing"} {
+		t.Run(path, func(t *testing.T) {
+			err := New(ts.URL + path).RequestID("X-Request-Id").VerifyRequestIDEcho("X-Request-Id").Do()
+			if !errors.Is(err, ErrRequestIDMismatch) {
+				t.Errorf("Expected ErrRequestIDMismatch, got %v", err)
+			}
+		})
+	}
+
+	t.Run("no verification", func(t *testing.T) {
+		if err := New(ts.URL + "/missing").RequestID("X-Request-Id").Do(); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
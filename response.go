@@ -0,0 +1,32 @@
+package rekwest
+
+import "net/http"
+
+// Response describes the exchange performed by `Do` when passed to Into.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// Body is a copy of the buffered response body that is owned by the
+	// caller. It is nil in case the body has not been read by rekwest, e.g.
+	// when using `Raw`.
+	Body []byte
+	// Target is decoded like the targets passed to `Do` in case it is set
+	// before performing the request.
+	Target interface{}
+}
+
+func (r *request) Into(res *Response) Rekwest {
+	r.into = res
+	return r
+}
+
+// populateInto copies the received response into the Response passed
+// to Into, if any.
+func (r *request) populateInto() {
+	if r.into == nil || r.response == nil {
+		return
+	}
+	r.into.StatusCode = r.response.StatusCode
+	r.into.Header = r.response.Header.Clone()
+	r.into.Body = r.ResponseBody()
+}
@@ -0,0 +1,62 @@
+package rekwest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRekwest_Into(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Animal-Count", "1")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"no such animal"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	t.Run("ok", func(t *testing.T) {
+		data := responseType{}
+		res := Response{Target: &data}
+		if err := New(ts.URL).Into(&res).Do(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if res.StatusCode != http.StatusCreated {
+			t.Errorf("Expected status 201, got %d", res.StatusCode)
+		}
+		if res.Header.Get("X-Animal-Count") != "1" {
+			t.Errorf("Unexpected header %v", res.Header)
+		}
+		if string(res.Body) != `{"ok":true,"animal":"platypus"}` {
+			t.Errorf("Unexpected body %q", res.Body)
+		}
+		if !data.OK || data.Animal != "platypus" {
+			t.Errorf("Expected target to be decoded, got %v", data)
+		}
+	})
+	t.Run("error status", func(t *testing.T) {
+		res := Response{}
+		if err := New(ts.URL + "/missing").Into(&res).Do(); err == nil {
+			t.Fatal("Expected error, got nil")
+		}
+		if res.StatusCode != http.StatusNotFound || string(res.Body) != `{"error":"no such animal"}` {
+			t.Errorf("Unexpected response %d %q", res.StatusCode, res.Body)
+		}
+	})
+	t.Run("owned body", func(t *testing.T) {
+		res := Response{}
+		r := New(ts.URL).ResponseFormat(ResponseFormatBytes).Into(&res)
+		if err := r.Do(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		res.Body[0] = 'X'
+		if body := r.ResponseBody(); body[0] != '{' {
+			t.Errorf("Expected body to be a copy, got %q", body)
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package rekwest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (r *request) Retry(attempts int) Rekwest {
+	r.retries = attempts
+	return r
+}
+
+func (r *request) RetryBackoff(base time.Duration, factor float64) Rekwest {
+	r.backoffBase = base
+	r.backoffFactor = factor
+	return r
+}
+
+// maxBackoff is the longest delay between retries. It is well below the
+// largest time.Duration, so the randomized delay cannot overflow.
+const maxBackoff = time.Duration(math.MaxInt64 / 2)
+
+// backoff returns the time to wait before the given retry, where the first
+// retry is 0. Half of the delay is randomized to spread out retries of
+// concurrent clients.
+func (r *request) backoff(retry int) time.Duration {
+	factor := r.backoffFactor
+	if factor <= 0 {
+		factor = 1
+	}
+	delay := float64(r.backoffBase) * math.Pow(factor, float64(retry))
+	// the delay is clamped while it is still a float, as converting values
+	// beyond the range of int64 is undefined
+	if !(delay > 0) {
+		return 0
+	}
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+	half := int64(delay) / 2
+	if half <= 0 {
+		return time.Duration(delay)
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// bufferBody reads a streamed request body into memory so it can be sent
+// again on each attempt.
+func (r *request) bufferBody() error {
+	if r.body == nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(r.body)
+	if err != nil {
+		bufferErr := MultiError{}
+		bufferErr.append(phaseBuild, fmt.Errorf("error buffering request body: %w", err))
+		return fmt.Errorf("could not perform request: %w", bufferErr)
+	}
+	r.Body(nil)
+	r.bodyBytes = b
+	return nil
+}
+
+// retry calls attempt until it succeeds or the configured number of retries
+// is exhausted. Transport errors and 5xx responses are retried, while
+// build errors, timeouts and canceled contexts are returned immediately.
+// All attempts share the request's timeout and context, so retries stop once
+// a delay requested by the backoff or the server would pass the deadline.
+// Waiting is aborted when the timeout or the request's context is done.
+func (r *request) retry(timeout requestTimeout, attempt func() (*http.Response, error)) (*http.Response, error) {
+	if r.retries > 0 && r.multipart == nil {
+		if err := r.bufferBody(); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; ; i++ {
+		res, err := attempt()
+		if i >= r.retries || r.multipart != nil {
+			return res, giveUp(i, err)
+		}
+		retry, err := r.shouldRetry(timeout, res, err)
+		if !retry {
+			return res, giveUp(i, err)
+		}
+		delay, ok := retryAfter(res)
+		if !ok {
+			delay = r.backoff(i)
+		}
+		// a retry that cannot start before the deadline would only fail
+		// with a timeout, so the outcome of the last attempt is kept instead
+		if deadline, ok := timeout.Deadline(); ok && !time.Now().Add(delay).Before(deadline) {
+			return res, giveUp(i, err)
+		}
+		if res != nil && res.Body != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		if delay > 0 {
+			wait := time.NewTimer(delay)
+			select {
+			case <-timeout.Done():
+				wait.Stop()
+				return nil, timeout.doneErr(r.context)
+			case <-wait.C:
+			}
+		}
+	}
+}
+
+// giveUp wraps the error of the last attempt, mentioning the number of
+// attempts that have been made in case the request has been retried.
+func giveUp(retry int, err error) error {
+	if err != nil && retry > 0 {
+		return fmt.Errorf("giving up after %d attempts: %w", retry+1, err)
+	}
+	return err
+}
+
+func (r *request) RetryOn(codes ...int) Rekwest {
+	r.retryOn = append(r.retryOn[:0:0], codes...)
+	return r
+}
+
+func (r *request) RetryIf(retry func(*http.Response, error) bool) Rekwest {
+	r.retryIf = retry
+	return r
+}
+
+func (r *request) RetryOnErrors(errs ...error) Rekwest {
+	r.retryOnErrors = append(r.retryOnErrors[:0:0], errs...)
+	return r
+}
+
+// shouldRetry returns whether the outcome of an attempt should be retried.
+// In case the body of a response needs to be inspected, it is buffered, so it
+// can still be read after the response is returned.
+func (r *request) shouldRetry(timeout requestTimeout, res *http.Response, err error) (bool, error) {
+	switch {
+	case r.retryIf != nil:
+		if r.retryIf(res, err) {
+			return true, err
+		}
+		if err != nil {
+			return false, err
+		}
+	case err != nil:
+		var multiErr MultiError
+		return errors.As(err, &multiErr) && len(multiErr.TransportErrors()) != 0 || r.retryError(err), err
+	case r.retryStatus(res.StatusCode):
+		return true, nil
+	}
+
+	// errors reading the body would only surface when decoding it, so the
+	// body is buffered within the attempt in case they are retried
+	var b []byte
+	buffered := false
+	if r.retryIf == nil && len(r.retryOnErrors) != 0 {
+		if b, err = r.bufferResponse(timeout, res); err != nil {
+			return r.retryError(err), err
+		}
+		buffered = true
+	}
+	if r.retryOnBody == nil || res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return false, nil
+	}
+	if !buffered {
+		if b, err = r.bufferResponse(timeout, res); err != nil {
+			return false, err
+		}
+	}
+	if b, err = r.decodedBody(res, b); err != nil {
+		return false, err
+	}
+	return r.retryOnBody(b), nil
+}
+
+// retryError returns whether the given error of an attempt matches one of
+// the errors passed to RetryOnErrors. Build errors are never retried.
+func (r *request) retryError(err error) bool {
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) {
+		return false
+	}
+	for _, candidate := range append(multiErr.TransportErrors(), multiErr.DecodeErrors()...) {
+		for _, target := range r.retryOnErrors {
+			if errors.Is(candidate, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryStatus returns whether a response with the given status is retried,
+// which are 5xx responses unless specified otherwise.
+func (r *request) retryStatus(status int) bool {
+	if r.retryOn == nil {
+		return status >= http.StatusInternalServerError
+	}
+	for _, code := range r.retryOn {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a 429
+// or 503 response, given in either seconds or as an HTTP date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (r *request) RetryOnBody(retry func(body []byte) bool) Rekwest {
+	r.retryOnBody = retry
+	return r
+}
+
+// bufferResponse reads the response body, bounded by the request's timeout
+// and context, and replaces it with an in memory copy.
+func (r *request) bufferResponse(timeout requestTimeout, res *http.Response) ([]byte, error) {
+	if res.Body == nil {
+		return nil, nil
+	}
+	var body io.Reader = res.Body
+	if r.maxBytes > 0 {
+		body = &limitedBody{ReadCloser: res.Body, limit: r.maxBytes}
+	}
+	type result struct {
+		body []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		b, err := ioutil.ReadAll(body)
+		done <- result{b, err}
+	}()
+
+	var b []byte
+	var err error
+	select {
+	case <-timeout.Done():
+		err = timeout.doneErr(r.context)
+	case result := <-done:
+		b, err = result.body, result.err
+		if err != nil && timeout.Err() != nil {
+			err = timeout.doneErr(r.context)
+		}
+	}
+	res.Body.Close()
+	if err != nil {
+		bufferErr := MultiError{}
+		bufferErr.append(phaseDecode, err)
+		return nil, fmt.Errorf("error handling the response: %w", bufferErr)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// decodedBody returns the buffered body of the response decompressed
+// according to its Content-Encoding, so the bytes match the ones targets are
+// decoded from. The response itself keeps the body as received.
+func (r *request) decodedBody(res *http.Response, b []byte) ([]byte, error) {
+	decoded := &http.Response{Header: res.Header.Clone(), Body: ioutil.NopCloser(bytes.NewReader(b))}
+	if !decompressBody(decoded) {
+		return b, nil
+	}
+	var body io.Reader = decoded.Body
+	if r.maxBytes > 0 {
+		body = &limitedBody{ReadCloser: decoded.Body, limit: r.maxBytes}
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		decodeErr := MultiError{}
+		decodeErr.append(phaseDecode, err)
+		return nil, fmt.Errorf("error handling the response: %w", decodeErr)
+	}
+	return b, nil
+}
@@ -0,0 +1,491 @@
+package rekwest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRekwest_Retry(t *testing.T) {
+	tests := []struct {
+		name             string
+		failures         int
+		status           int
+		retries          int
+		expectedAttempts int
+		expectError      bool
+	}{
+		{"success after 5xx", 2, http.StatusServiceUnavailable, 3, 3, false},
+		{"exhausted", 5, http.StatusBadGateway, 2, 3, true},
+		{"4xx is not retried", 5, http.StatusNotFound, 3, 1, true},
+		{"no retries", 1, http.StatusInternalServerError, 0, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			var mu sync.Mutex
+			var bodies []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+				b, _ := ioutil.ReadAll(r.Body)
+				mu.Lock()
+				bodies = append(bodies, string(b))
+				mu.Unlock()
+				if int(attempt) <= test.failures {
+					w.WriteHeader(test.status)
+					return
+				}
+				w.Write(b)
+			}))
+			defer ts.Close()
+
+			var data []byte
+			err := New(ts.URL).
+				Method(http.MethodPost).
+				Body(strings.NewReader("platypus")).
+				ResponseFormat(ResponseFormatBytes).
+				Retry(test.retries).
+				Do(&data)
+			if test.expectError != (err != nil) {
+				t.Fatalf("Unexpected error value %v", err)
+			}
+			if int(atomic.LoadInt32(&attempts)) != test.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", test.expectedAttempts, atomic.LoadInt32(&attempts))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, body := range bodies {
+				if body != "platypus" {
+					t.Errorf("Expected full body on each attempt, got %q", body)
+				}
+			}
+			if !test.expectError && string(data) != "platypus" {
+				t.Errorf("Unexpected response %v", data)
+			}
+		})
+	}
+}
+
+func TestRekwest_BodyProvider(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		first := len(bodies) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	var calls int
+	var data []byte
+	err := New(ts.URL).
+		Method(http.MethodPut).
+		BodyProvider(func() (io.ReadCloser, error) {
+			calls++
+			return ioutil.NopCloser(strings.NewReader("platypus")), nil
+		}).
+		ResponseFormat(ResponseFormatBytes).
+		Retry(1).
+		Do(&data)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected provider to be called twice, got %d", calls)
+	}
+	mu.Lock()
+	if len(bodies) != 2 || bodies[0] != "platypus" || bodies[1] != "platypus" {
+		t.Errorf("Expected identical bodies on each attempt, got %q", bodies)
+	}
+	mu.Unlock()
+	if string(data) != "platypus" {
+		t.Errorf("Unexpected response %v", data)
+	}
+
+	providerErr := errors.New("no body")
+	err = New(ts.URL).
+		Method(http.MethodPut).
+		BodyProvider(func() (io.ReadCloser, error) {
+			return nil, providerErr
+		}).
+		Do(nil)
+	if !errors.Is(err, providerErr) {
+		t.Errorf("Expected provider error, got %v", err)
+	}
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+		t.Errorf("Expected a single build error, got %v", err)
+	}
+}
+
+func TestRekwest_RetryTransportError(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		conn.Close()
+	}))
+	defer ts.Close()
+
+	err := New(ts.URL).Method(http.MethodPost).BytesBody([]byte("platypus")).Retry(2).Do()
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("Expected 3 attempts, got %d", atomic.LoadInt32(&attempts))
+	}
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) || len(multiErr.TransportErrors()) != 1 {
+		t.Errorf("Expected last transport error to be wrapped, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Errorf("Unexpected error message %v", err)
+	}
+}
+
+func TestRekwest_RetryBackoff(t *testing.T) {
+	r := &request{backoffBase: 100 * time.Millisecond, backoffFactor: 2}
+	for retry, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		for i := 0; i < 10; i++ {
+			if delay := r.backoff(retry); delay < expected/2 || delay > expected {
+				t.Errorf("Expected delay of retry %d to be within [%v, %v], got %v", retry, expected/2, expected, delay)
+			}
+		}
+	}
+
+	huge := &request{backoffBase: 1 << 62, backoffFactor: 1e12}
+	for retry := 0; retry < 10; retry++ {
+		if delay := huge.backoff(retry); delay < maxBackoff/2 || delay > maxBackoff {
+			t.Errorf("Expected delay of retry %d to be capped at %v, got %v", retry, maxBackoff, delay)
+		}
+	}
+	if delay := (&request{backoffBase: 1, backoffFactor: 1}).backoff(3); delay != 1 {
+		t.Errorf("Expected delay of a single nanosecond to be kept, got %v", delay)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	t.Run("large values", func(t *testing.T) {
+		err := New(failing.URL).Timeout(50*time.Millisecond).Retry(5).RetryBackoff(time.Duration(math.MaxInt64), math.MaxFloat64).Do()
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected error of the last attempt, got %v", err)
+		}
+	})
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		err := New(failing.URL).Context(ctx).Retry(3).RetryBackoff(time.Hour, 2).Do()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context cancellation, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected backoff to be aborted, took %v", elapsed)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		err := New(failing.URL).Timeout(50*time.Millisecond).Retry(3).RetryBackoff(time.Hour, 2).Do()
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected error of the last attempt, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+			t.Errorf("Expected backoff past the deadline not to be started, took %v", elapsed)
+		}
+	})
+}
+
+func TestRekwest_RetryDeadline(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	err := New(ts.URL).Context(ctx).Retry(100).RetryBackoff(40*time.Millisecond, 1).Do()
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if overrun := time.Since(deadline); overrun > 20*time.Millisecond {
+		t.Errorf("Expected retries to cease at the deadline, overran by %v", overrun)
+	}
+	if atomic.LoadInt32(&attempts) < 3 || atomic.LoadInt32(&attempts) > 15 {
+		t.Errorf("Expected retries until the deadline, got %d attempts", atomic.LoadInt32(&attempts))
+	}
+}
+
+func TestRekwest_RetryOnBody(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if attempt <= 2 {
+			w.Write([]byte(`{"status":"pending"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"done"}`))
+	}))
+	defer ts.Close()
+
+	pending := func(body []byte) bool {
+		return strings.Contains(string(body), "pending")
+	}
+
+	t.Run("done", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		var data struct{ Status string }
+		err := New(ts.URL).
+			Retry(3).
+			RetryBackoff(time.Millisecond, 2).
+			RetryOnBody(pending).
+			Do(&data)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if data.Status != "done" {
+			t.Errorf("Expected status done, got %v", data.Status)
+		}
+		if atomic.LoadInt32(&attempts) != 3 {
+			t.Errorf("Expected 3 attempts, got %d", atomic.LoadInt32(&attempts))
+		}
+	})
+	t.Run("exhausted", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		var data struct{ Status string }
+		err := New(ts.URL).Retry(1).RetryOnBody(pending).Do(&data)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if data.Status != "pending" {
+			t.Errorf("Expected last response to be decoded, got %v", data.Status)
+		}
+		if atomic.LoadInt32(&attempts) != 2 {
+			t.Errorf("Expected 2 attempts, got %d", atomic.LoadInt32(&attempts))
+		}
+	})
+}
+
+func TestRekwest_RetryOnBodyCompressed(t *testing.T) {
+	compress := func(s string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return buf.Bytes()
+	}
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Write(compress(`{"status":"pending"}`))
+			return
+		}
+		w.Write(compress(`{"status":"done"}`))
+	}))
+	defer ts.Close()
+
+	var bodies []string
+	var data struct{ Status string }
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	err := New(ts.URL).
+		Client(client).
+		Retry(1).
+		RetryOnBody(func(body []byte) bool {
+			bodies = append(bodies, string(body))
+			return strings.Contains(string(body), "pending")
+		}).
+		Do(&data)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := []string{`{"status":"pending"}`}; !reflect.DeepEqual(expected, bodies) {
+		t.Errorf("Expected predicate to see decompressed bodies %q, got %q", expected, bodies)
+	}
+	if data.Status != "done" {
+		t.Errorf("Expected status done, got %v", data.Status)
+	}
+}
+
+func TestRekwest_RetryOn(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		configure        func(Rekwest) Rekwest
+		expectedAttempts int
+	}{
+		{
+			"429 retried",
+			http.StatusTooManyRequests,
+			func(r Rekwest) Rekwest { return r.RetryOn(http.StatusTooManyRequests) },
+			3,
+		},
+		{
+			"500 not retried",
+			http.StatusInternalServerError,
+			func(r Rekwest) Rekwest { return r.RetryOn(http.StatusTooManyRequests) },
+			1,
+		},
+		{
+			"predicate",
+			http.StatusConflict,
+			func(r Rekwest) Rekwest {
+				return r.RetryIf(func(res *http.Response, err error) bool {
+					return err == nil && res.StatusCode == http.StatusConflict
+				})
+			},
+			3,
+		},
+		{
+			"predicate replaces default",
+			http.StatusBadGateway,
+			func(r Rekwest) Rekwest {
+				return r.RetryIf(func(res *http.Response, err error) bool {
+					return false
+				})
+			},
+			1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(test.status)
+			}))
+			defer ts.Close()
+
+			if err := test.configure(New(ts.URL).Retry(2)).Do(); err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if int(atomic.LoadInt32(&attempts)) != test.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", test.expectedAttempts, atomic.LoadInt32(&attempts))
+			}
+		})
+	}
+}
+
+func TestRekwest_RetryOnErrors(t *testing.T) {
+	tests := []struct {
+		name             string
+		errs             []error
+		expectedAttempts int32
+	}{
+		{"matching error", []error{context.Canceled, io.ErrUnexpectedEOF}, 2},
+		{"other error", []error{context.Canceled}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) > 1 {
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+					return
+				}
+				// announce the entire body but close the connection halfway through
+				conn, rw, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("Unexpected error %v", err)
+					return
+				}
+				rw.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 31\r\n\r\n{\"ok\":true,")
+				rw.Flush()
+				conn.Close()
+			}))
+			defer ts.Close()
+
+			data := responseType{}
+			err := New(ts.URL).Retry(2).RetryOnErrors(test.errs...).Do(&data)
+			if atomic.LoadInt32(&attempts) != test.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", test.expectedAttempts, atomic.LoadInt32(&attempts))
+			}
+			if test.expectedAttempts == 1 {
+				if !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Errorf("Expected unexpected EOF, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !data.OK || data.Animal != "platypus" {
+				t.Errorf("Expected response of second attempt to be decoded, got %v", data)
+			}
+		})
+	}
+}
+
+func TestRekwest_RetryAfter(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	err := New(ts.URL).
+		Retry(1).
+		RetryOn(http.StatusTooManyRequests).
+		RetryBackoff(time.Millisecond, 1).
+		Do()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected Retry-After to be honored, retried after %v", elapsed)
+	}
+
+	date := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": []string{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}},
+	}
+	if delay, ok := retryAfter(date); !ok || delay < 58*time.Second || delay > time.Minute {
+		t.Errorf("Unexpected delay %v for HTTP date", delay)
+	}
+	ignored := &http.Response{
+		StatusCode: http.StatusInternalServerError,
+		Header:     http.Header{"Retry-After": []string{"10"}},
+	}
+	if _, ok := retryAfter(ignored); ok {
+		t.Error("Expected Retry-After of 500 response to be ignored")
+	}
+}
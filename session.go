@@ -0,0 +1,79 @@
+package rekwest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Session creates requests sharing the same defaults, e.g. for talking to a
+// single API. The zero value creates requests like New. A Session must not
+// be modified while requests are being created from it.
+type Session struct {
+	// BaseURL is prepended to the path of each request. The path is joined
+	// with the path of the URL, so its query and fragment are kept.
+	BaseURL string
+	// Header holds headers sent with each request. Headers set on a request
+	// replace the default values of the same key.
+	Header http.Header
+	// Timeout is used for each request unless it is zero.
+	Timeout time.Duration
+	// Client is used for performing each request unless it is nil.
+	Client *http.Client
+	// Options are applied in order to each request, e.g. for setting
+	// credentials using BearerToken or a shared CookieJar.
+	Options []Option
+}
+
+// New creates a new Rekwest that will perform requests against the given
+// path relative to the session's base URL, seeded with the session's
+// defaults. Calling methods on the returned Rekwest overrides them.
+func (s *Session) New(path string) Rekwest {
+	joined, err := joinPath(s.BaseURL, path)
+	r := New(joined).(*request)
+	if err != nil {
+		r.buildError(err)
+	}
+	if len(s.Header) != 0 {
+		r.defaultHeader = make(http.Header, len(s.Header))
+		for key, values := range s.Header {
+			r.defaultHeader[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+	}
+	if s.Timeout != 0 {
+		r.Timeout(s.Timeout)
+	}
+	if s.Client != nil {
+		r.Client(s.Client)
+	}
+	for _, opt := range s.Options {
+		opt(r)
+	}
+	return r
+}
+
+// joinPath appends the given path to the path of the base URL, ensuring
+// both are separated by a single slash. The query and fragment of the base
+// URL are kept, and a query given with the path is added to them.
+func joinPath(base, path string) (string, error) {
+	if base == "" || path == "" {
+		return base + path, nil
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base, fmt.Errorf("invalid base URL %q: %w", base, err)
+	}
+	path, query, hasQuery := strings.Cut(path, "?")
+	if err := joinURLPath(u, path); err != nil {
+		return base, err
+	}
+	if hasQuery {
+		if u.RawQuery != "" {
+			query = u.RawQuery + "&" + query
+		}
+		u.RawQuery = query
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,136 @@
+package rekwest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSession_New(t *testing.T) {
+	var path string
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		header = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"animal":"platypus"}`))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: http.DefaultTransport}
+	session := &Session{
+		BaseURL: ts.URL + "/api/",
+		Header:  http.Header{"x-animal": {"platypus"}, "Accept": {"application/json"}},
+		Timeout: time.Second,
+		Client:  client,
+		Options: []Option{
+			func(r Rekwest) {
+				r.BearerToken("secret")
+			},
+		},
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		var data responseType
+		r := session.New("/animals")
+		if err := r.Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if path != "/api/animals" {
+			t.Errorf("Unexpected path %v", path)
+		}
+		if header.Get("X-Animal") != "platypus" || header.Get("Accept") != "application/json" {
+			t.Errorf("Expected default headers, got %v", header)
+		}
+		if header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Expected bearer token, got %v", header)
+		}
+		if data != (responseType{OK: true, Animal: "platypus"}) {
+			t.Errorf("Unexpected response %v", data)
+		}
+		seeded := r.(*request)
+		if seeded.client != client || seeded.timeout == nil || *seeded.timeout != time.Second {
+			t.Errorf("Expected client and timeout of session, got %v and %v", seeded.client, seeded.timeout)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		err := session.New("animals").
+			Header("X-Animal", "echidna").
+			BearerToken("other").
+			Timeout(2 * time.Second).
+			Do()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if path != "/api/animals" {
+			t.Errorf("Unexpected path %v", path)
+		}
+		if expected := []string{"echidna"}; !reflect.DeepEqual(expected, header["X-Animal"]) {
+			t.Errorf("Expected header %v, got %v", expected, header["X-Animal"])
+		}
+		if header.Get("Authorization") != "Bearer other" {
+			t.Errorf("Expected overridden bearer token, got %v", header)
+		}
+	})
+
+	t.Run("independent requests", func(t *testing.T) {
+		if err := session.New("animals").Header("X-Animal", "echidna").Do(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := session.New("animals").Do(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if expected := []string{"platypus"}; !reflect.DeepEqual(expected, header["X-Animal"]) {
+			t.Errorf("Expected header %v, got %v", expected, header["X-Animal"])
+		}
+		if expected := []string{"platypus"}; !reflect.DeepEqual(expected, session.Header["x-animal"]) {
+			t.Errorf("Expected session header not to be mutated, got %v", session.Header)
+		}
+	})
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		base, path, expected string
+	}{
+		{"https://www.example.com/api", "animals", "https://www.example.com/api/animals"},
+		{"https://www.example.com/api/", "/animals", "https://www.example.com/api/animals"},
+		{"https://www.example.com", "", "https://www.example.com"},
+		{"", "https://www.example.com/animals", "https://www.example.com/animals"},
+		{"https://www.example.com/api?key=1", "animals", "https://www.example.com/api/animals?key=1"},
+		{"https://www.example.com/api?key=1#top", "animals?kind=platypus", "https://www.example.com/api/animals?key=1&kind=platypus#top"},
+		{"https://www.example.com/api/", "duck billed", "https://www.example.com/api/duck%20billed"},
+	}
+	for _, test := range tests {
+		result, err := joinPath(test.base, test.path)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if result != test.expected {
+			t.Errorf("Expected %v, got %v", test.expected, result)
+		}
+	}
+
+	if _, err := joinPath("https://www.example.com/api", "../admin"); err == nil {
+		t.Error("Expected dot segments to be rejected")
+	}
+}
+
+func TestSession_BaseURLQuery(t *testing.T) {
+	var requestURI string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+	}))
+	defer ts.Close()
+
+	session := &Session{BaseURL: ts.URL + "/api?key=1"}
+	if err := session.New("animals").Do(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if expected := "/api/animals?key=1"; requestURI != expected {
+		t.Errorf("Expected %v, got %v", expected, requestURI)
+	}
+}
@@ -0,0 +1,29 @@
+package rekwest
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// sniffContentType returns the content type detected from the first bytes
+// of the given body. Only types that can be decoded are returned, so that
+// the URL path fallback still applies for anything else.
+func sniffContentType(body []byte) string {
+	head := body
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	if trimmed := bytes.TrimLeft(head, " \t\r\n"); len(trimmed) != 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		// http.DetectContentType does not know about JSON
+		return contentTypeJSON
+	}
+	switch contentType := http.DetectContentType(head); contentType {
+	case "text/xml; charset=utf-8":
+		return contentType
+	default:
+		return ""
+	}
+}
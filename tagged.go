@@ -0,0 +1,221 @@
+package rekwest
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// taggedValue converts the given value into a structure of maps and slices
+// that encoding/json will marshal according to the names in the given struct
+// tag key instead of the `json` tag. It follows the same rules as
+// encoding/json, i.e. `-` skips a field, `omitempty` skips zero values and
+// values implementing json.Marshaler or encoding.TextMarshaler, including
+// addressable values with pointer receivers, are marshaled by themselves.
+// Like encoding/json, it fails for cyclic values.
+func taggedValue(v reflect.Value, tagKey string) (interface{}, error) {
+	t := &tagger{key: tagKey, visiting: map[uintptr]bool{}}
+	return t.value(v)
+}
+
+// tagger holds the state of converting a value using taggedValue.
+type tagger struct {
+	key string
+	// visiting holds the pointers that are currently being converted,
+	// which would be converted again in case of a cycle
+	visiting map[uintptr]bool
+}
+
+func (t *tagger) value(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if marshaler, ok := marshalerValue(v); ok {
+		return marshaler, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return t.value(v.Elem())
+		}
+		return t.visit(v, func() (interface{}, error) {
+			return t.value(v.Elem())
+		})
+	case reflect.Struct:
+		fields := map[string]interface{}{}
+		if err := t.fields(v, fields); err != nil {
+			return nil, err
+		}
+		return fields, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil
+		}
+		convert := func() (interface{}, error) {
+			elems := make([]interface{}, v.Len())
+			for i := range elems {
+				elem, err := t.value(v.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				elems[i] = elem
+			}
+			return elems, nil
+		}
+		if v.Kind() == reflect.Slice && v.Len() != 0 {
+			return t.visit(v, convert)
+		}
+		return convert()
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface(), nil
+		}
+		return t.visit(v, func() (interface{}, error) {
+			entries := make(map[string]interface{}, v.Len())
+			for _, key := range v.MapKeys() {
+				entry, err := t.value(v.MapIndex(key))
+				if err != nil {
+					return nil, err
+				}
+				entries[key.String()] = entry
+			}
+			return entries, nil
+		})
+	default:
+		return v.Interface(), nil
+	}
+}
+
+// marshalerValue returns the value to pass to encoding/json in case the
+// given value marshals itself. Like encoding/json, methods with pointer
+// receivers are only used in case the value is addressable.
+func marshalerValue(v reflect.Value) (interface{}, bool) {
+	if v.Kind() == reflect.Interface || !v.CanInterface() {
+		return nil, false
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	if t := v.Type(); t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface(), true
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		if t := reflect.PtrTo(v.Type()); t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+			return v.Addr().Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// visit converts the value referenced by the given pointer, map or slice
+// using convert, failing in case it is already being converted.
+func (t *tagger) visit(v reflect.Value, convert func() (interface{}, error)) (interface{}, error) {
+	ptr := v.Pointer()
+	if t.visiting[ptr] {
+		return nil, fmt.Errorf("json: unsupported value: encountered a cycle via %s", v.Type())
+	}
+	t.visiting[ptr] = true
+	defer delete(t.visiting, ptr)
+	return convert()
+}
+
+func (t *tagger) fields(v reflect.Value, fields map[string]interface{}) error {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get(t.key)
+		if tag == "-" {
+			continue
+		}
+		name, omitEmpty := parseTag(tag)
+		value := v.Field(i)
+
+		if field.Anonymous && name == "" {
+			embedded := value
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					continue
+				}
+				embedded = value.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inline := func() (interface{}, error) {
+					return nil, t.fields(embedded, fields)
+				}
+				var err error
+				if value.Kind() == reflect.Ptr {
+					_, err = t.visit(value, inline)
+				} else {
+					_, err = inline()
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			value = embedded
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		converted, err := t.value(value)
+		if err != nil {
+			return err
+		}
+		fields[name] = converted
+	}
+	return nil
+}
+
+// parseTag splits a struct tag into its name and whether the
+// `omitempty` option is set.
+func parseTag(tag string) (string, bool) {
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			return parts[0], true
+		}
+	}
+	return parts[0], false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
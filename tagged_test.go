@@ -0,0 +1,96 @@
+package rekwest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type pointerMarshaler struct {
+	V int
+}
+
+func (p *pointerMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"custom"`), nil
+}
+
+type pointerTextMarshaler struct {
+	V int
+}
+
+func (p *pointerTextMarshaler) MarshalText() ([]byte, error) {
+	return []byte("text"), nil
+}
+
+type cyclicNode struct {
+	Name string      `apijson:"name"`
+	Next *cyclicNode `apijson:"next,omitempty"`
+}
+
+type embeddedNode struct {
+	*embeddedNode
+	Name string
+}
+
+func TestTaggedValue(t *testing.T) {
+	shared := &pointerMarshaler{}
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"pointer receiver", &struct {
+			A pointerMarshaler
+			B pointerTextMarshaler
+		}{}},
+		{"pointer field", struct {
+			A *pointerMarshaler
+			B *pointerMarshaler
+		}{A: shared, B: shared}},
+		{"nil pointer", struct {
+			A *pointerMarshaler
+		}{}},
+		{"not addressable", struct {
+			A pointerMarshaler
+		}{}},
+		{"shared values", &struct {
+			A, B *cyclicNode
+		}{A: &cyclicNode{Name: "a"}, B: &cyclicNode{Name: "a"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := taggedValue(reflect.ValueOf(test.value), "json")
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			tagged, _ := json.Marshal(value)
+			expected, _ := json.Marshal(test.value)
+			if string(tagged) != string(expected) {
+				t.Errorf("Expected %s, got %s", expected, tagged)
+			}
+		})
+	}
+
+	t.Run("cycles", func(t *testing.T) {
+		node := &cyclicNode{Name: "platypus"}
+		node.Next = node
+		embedded := &embeddedNode{Name: "platypus"}
+		embedded.embeddedNode = embedded
+		m := map[string]interface{}{}
+		m["self"] = m
+
+		for _, value := range []interface{}{node, embedded, m} {
+			if _, err := taggedValue(reflect.ValueOf(value), "apijson"); err == nil || !strings.Contains(err.Error(), "encountered a cycle") {
+				t.Errorf("Expected cycle to be detected for %T, got %v", value, err)
+			}
+		}
+
+		err := New("http://www.example.com").Method(http.MethodPost).JSONBodyTagged(node, "apijson").Do()
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+			t.Errorf("Expected cycle to be reported as build error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package rekwest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// transportConfig holds the transport options of a request. It is
+// comparable, so transports configured the same way can be shared.
+type transportConfig struct {
+	minTLSVersion            uint16
+	tlsServerName            string
+	responseHeaderTimeout    time.Duration
+	setResponseHeaderTimeout bool
+	resolver                 *net.Resolver
+	readDeadline             time.Duration
+	writeDeadline            time.Duration
+}
+
+// transportKey identifies a transport cloned from base using config.
+type transportKey struct {
+	base   *http.Transport
+	config transportConfig
+}
+
+// transports caches the cloned transports, so requests using the same
+// options share their connection pool instead of leaving idle connections
+// behind in a transport that is never used again.
+var transports = struct {
+	sync.Mutex
+	cloned map[transportKey]*http.Transport
+}{cloned: map[transportKey]*http.Transport{}}
+
+// httpClient returns the client that is used for performing the request.
+// In case transport options or a cookie jar have been set, the client is
+// copied and the client's transport is replaced with a clone the options
+// are applied to, so the given client is never mutated. Clones are shared
+// by all requests using the same options on the same transport. The
+// resulting client is reused for subsequent calls.
+func (r *request) httpClient() (*http.Client, error) {
+	customTransport := r.transport != transportConfig{}
+	if !customTransport && r.jar == nil {
+		return r.client, nil
+	}
+	if r.transportClient != nil {
+		return r.transportClient, nil
+	}
+
+	client := *r.client
+	if r.jar != nil {
+		client.Jar = r.jar
+	}
+	if customTransport {
+		var base *http.Transport
+		switch t := r.client.Transport.(type) {
+		case nil:
+			base = http.DefaultTransport.(*http.Transport)
+		case *http.Transport:
+			base = t
+		default:
+			return nil, fmt.Errorf("cannot apply transport options to transport of type %T", t)
+		}
+		client.Transport = cloneTransport(base, r.transport)
+	}
+	r.transportClient = &client
+	return r.transportClient, nil
+}
+
+// cloneTransport returns the clone of base the given options have been
+// applied to, which is created on first use.
+func cloneTransport(base *http.Transport, config transportConfig) *http.Transport {
+	key := transportKey{base, config}
+	transports.Lock()
+	defer transports.Unlock()
+	if transport, ok := transports.cloned[key]; ok {
+		return transport
+	}
+
+	transport := base.Clone()
+	if config.minTLSVersion != 0 || config.tlsServerName != "" {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		} else {
+			transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+		}
+		if config.minTLSVersion != 0 {
+			transport.TLSClientConfig.MinVersion = config.minTLSVersion
+		}
+		if config.tlsServerName != "" {
+			transport.TLSClientConfig.ServerName = config.tlsServerName
+		}
+	}
+	if config.setResponseHeaderTimeout {
+		transport.ResponseHeaderTimeout = config.responseHeaderTimeout
+	}
+	if dial := config.dialContext(transport); dial != nil {
+		transport.DialContext = dial
+	}
+	transports.cloned[key] = transport
+	return transport
+}
+
+// setTransport updates the transport options of the request, which then
+// needs a new client.
+func (r *request) setTransport(update func(*transportConfig)) Rekwest {
+	update(&r.transport)
+	r.transportClient = nil
+	return r
+}
+
+func (r *request) MinTLSVersion(version uint16) Rekwest {
+	return r.setTransport(func(c *transportConfig) {
+		c.minTLSVersion = version
+	})
+}
+
+func (r *request) TLSServerName(name string) Rekwest {
+	return r.setTransport(func(c *transportConfig) {
+		c.tlsServerName = name
+	})
+}
+
+func (r *request) ResponseHeaderTimeout(value time.Duration) Rekwest {
+	return r.setTransport(func(c *transportConfig) {
+		c.responseHeaderTimeout = value
+		c.setResponseHeaderTimeout = true
+	})
+}
+
+func (r *request) Resolver(resolver *net.Resolver) Rekwest {
+	return r.setTransport(func(c *transportConfig) {
+		c.resolver = resolver
+	})
+}
+
+func (r *request) SocketDeadlines(read, write time.Duration) Rekwest {
+	return r.setTransport(func(c *transportConfig) {
+		c.readDeadline, c.writeDeadline = read, write
+	})
+}
+
+// dialContext returns the dial function of a transport cloned from the given
+// one, which uses the configured resolver and wraps connections so they
+// apply the socket deadlines. Both are composed in a single function, so the
+// order in which they have been set does not matter. It returns nil in case
+// the dial function of the transport is kept as is.
+func (c transportConfig) dialContext(t *http.Transport) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.resolver == nil && c.readDeadline <= 0 && c.writeDeadline <= 0 {
+		return nil
+	}
+	dial := t.DialContext
+	switch {
+	case c.resolver != nil:
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  c.resolver,
+		}
+		dial = dialer.DialContext
+	case dial == nil:
+		dial = (&net.Dialer{}).DialContext
+	}
+	read, write := c.readDeadline, c.writeDeadline
+	if read <= 0 && write <= 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &deadlineConn{Conn: conn, read: read, write: write}, nil
+	}
+}
+
+// deadlineConn is a connection that sets a fresh deadline before each read
+// or write, so a stalled peer cannot block it indefinitely.
+type deadlineConn struct {
+	net.Conn
+	read, write time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.read > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.read)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.write > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.write)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,335 @@
+package rekwest
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveDNS answers all DNS queries read from conn using TCP framing. A queries
+// are answered using the given address, all other queries get an empty answer.
+func serveDNS(conn net.Conn, ip net.IP) {
+	defer conn.Close()
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		// the question section ends after the name's terminating zero label
+		// followed by two bytes of type and class each
+		end := 12
+		for query[end] != 0 {
+			end += int(query[end]) + 1
+		}
+		end += 5
+		qtype := binary.BigEndian.Uint16(query[end-4:])
+
+		answer := append([]byte{}, query[:end]...)
+		answer[2], answer[3] = 0x81, 0x80
+		binary.BigEndian.PutUint16(answer[8:], 0)
+		binary.BigEndian.PutUint16(answer[10:], 0)
+		if qtype == 1 {
+			binary.BigEndian.PutUint16(answer[6:], 1)
+			answer = append(answer, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+			answer = append(answer, ip.To4()...)
+		} else {
+			binary.BigEndian.PutUint16(answer[6:], 0)
+		}
+
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(answer))); err != nil {
+			return
+		}
+		if _, err := conn.Write(answer); err != nil {
+			return
+		}
+	}
+}
+
+func TestRekwest_Resolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(r.Host))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Host = "rekwest.test:" + u.Port()
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveDNS(server, net.IPv4(127, 0, 0, 1))
+			return client, nil
+		},
+	}
+
+	var host []byte
+	if err := New(u.String()).Resolver(resolver).Do(&host); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(host) != u.Host {
+		t.Errorf("Expected host %s, got %s", u.Host, string(host))
+	}
+}
+
+func TestRekwest_TransportRetry(t *testing.T) {
+	requests := 0
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if requests%3 == 2 {
+			// reset the reused keep alive connection without responding
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	tests := map[string]func(Rekwest){
+		"get": func(r Rekwest) {},
+		"idempotent post": func(r Rekwest) {
+			r.Method(http.MethodPost).Header("Idempotency-Key", "abc").BytesBody([]byte("platypus"))
+		},
+	}
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			requests, bodies = 0, nil
+			client := &http.Client{Transport: &http.Transport{}}
+			for i := 0; i < 2; i++ {
+				r := New(ts.URL).Client(client)
+				setup(r)
+				var data []byte
+				if err := r.Do(&data); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if string(data) != "ok" {
+					t.Errorf("Expected ok, got %s", string(data))
+				}
+			}
+			if requests != 3 {
+				t.Errorf("Expected 3 requests, got %d", requests)
+			}
+			for _, body := range bodies {
+				if body != bodies[0] {
+					t.Errorf("Expected all bodies to equal %q, got %q", bodies[0], body)
+				}
+			}
+		})
+	}
+}
+
+func TestRekwest_SocketDeadlines(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow-body":
+			w.Write([]byte("platy"))
+			w.(http.Flusher).Flush()
+			<-release
+			w.Write([]byte("pus"))
+		case "/not-reading":
+			<-release
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	tests := []struct {
+		name    string
+		request Rekwest
+	}{
+		{"read", New(ts.URL+"/slow-body").SocketDeadlines(50*time.Millisecond, 0)},
+		{
+			"write",
+			New(ts.URL+"/not-reading").
+				Method(http.MethodPost).
+				BytesBody(make([]byte, 64<<20)).
+				SocketDeadlines(0, 50*time.Millisecond),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			start := time.Now()
+			err := test.request.Timeout(5 * time.Second).Do(&data)
+			var multiErr MultiError
+			if !errors.As(err, &multiErr) || len(multiErr.Errors) != 1 {
+				t.Fatalf("Expected a single error, got %v", err)
+			}
+			var netErr net.Error
+			if !errors.As(multiErr.Errors[0], &netErr) || !netErr.Timeout() {
+				t.Errorf("Expected socket timeout, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected deadline to trigger early, took %v", elapsed)
+			}
+		})
+	}
+
+	t.Run("no deadline hit", func(t *testing.T) {
+		var data []byte
+		err := New(ts.URL+"/fast").SocketDeadlines(time.Second, time.Second).Do(&data)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	})
+}
+
+func TestRekwest_ResolverSocketDeadlines(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("platy"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("pus"))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	u, _ := url.Parse(ts.URL)
+	u.Host = "rekwest.test:" + u.Port()
+
+	tests := map[string]func(Rekwest, *net.Resolver) Rekwest{
+		"resolver first": func(r Rekwest, resolver *net.Resolver) Rekwest {
+			return r.Resolver(resolver).SocketDeadlines(50*time.Millisecond, 0)
+		},
+		"deadlines first": func(r Rekwest, resolver *net.Resolver) Rekwest {
+			return r.SocketDeadlines(50*time.Millisecond, 0).Resolver(resolver)
+		},
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			var lookups int32
+			resolver := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					atomic.AddInt32(&lookups, 1)
+					client, server := net.Pipe()
+					go serveDNS(server, net.IPv4(127, 0, 0, 1))
+					return client, nil
+				},
+			}
+
+			var data []byte
+			err := configure(New(u.String()).Timeout(5*time.Second), resolver).Do(&data)
+			var multiErr MultiError
+			if !errors.As(err, &multiErr) || len(multiErr.Errors) != 1 {
+				t.Fatalf("Expected a single error, got %v", err)
+			}
+			var netErr net.Error
+			if !errors.As(multiErr.Errors[0], &netErr) || !netErr.Timeout() {
+				t.Errorf("Expected socket timeout, got %v", err)
+			}
+			if atomic.LoadInt32(&lookups) == 0 {
+				t.Error("Expected host to be looked up using the resolver")
+			}
+		})
+	}
+}
+
+func TestRekwest_TransportReuse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("platypus"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if err := New(ts.URL).Client(client).ResponseHeaderTimeout(time.Second).Do(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before+10 {
+		t.Errorf("Expected cloned transports to be reused, goroutines grew from %d to %d", before, after)
+	}
+
+	first, _ := New(ts.URL).Client(client).ResponseHeaderTimeout(time.Second).(*request).httpClient()
+	second, _ := New(ts.URL).Client(client).ResponseHeaderTimeout(time.Second).(*request).httpClient()
+	other, _ := New(ts.URL).Client(client).ResponseHeaderTimeout(time.Minute).(*request).httpClient()
+	if first.Transport != second.Transport {
+		t.Error("Expected requests using the same options to share a transport")
+	}
+	if first.Transport == other.Transport || other.Transport.(*http.Transport).ResponseHeaderTimeout != time.Minute {
+		t.Errorf("Expected requests using other options to use a transport of their own, got %v", other.Transport)
+	}
+}
+
+func TestRekwest_MinTLSVersion(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("platypus"))
+	}))
+	ts.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+	ts.StartTLS()
+	defer ts.Close()
+
+	t.Run("accepted", func(t *testing.T) {
+		var data []byte
+		if err := New(ts.URL).Client(ts.Client()).MinTLSVersion(tls.VersionTLS10).Do(&data); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if string(data) != "platypus" {
+			t.Errorf("Expected platypus, got %v", string(data))
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		err := New(ts.URL).Client(ts.Client()).MinTLSVersion(tls.VersionTLS12).Do()
+		var multiErr MultiError
+		if !errors.As(err, &multiErr) || len(multiErr.TransportErrors()) != 1 {
+			t.Errorf("Expected a transport error, got %v", err)
+		}
+	})
+}
+
+func TestRekwest_TLSServerName(t *testing.T) {
+	var serverName string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("platypus"))
+	}))
+	ts.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// the certificate of the test server is valid for example.com
+	var data []byte
+	if err := New(ts.URL).Client(ts.Client()).TLSServerName("example.com").Do(&data); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if serverName != "example.com" {
+		t.Errorf("Expected SNI example.com, got %q", serverName)
+	}
+
+	err := New(ts.URL).Client(ts.Client()).TLSServerName("www.example.org").Do()
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) || len(multiErr.TransportErrors()) != 1 {
+		t.Errorf("Expected certificate verification to fail, got %v", err)
+	}
+}
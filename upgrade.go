@@ -0,0 +1,84 @@
+package rekwest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+)
+
+func (r *request) Upgrade(protocol string) (conn net.Conn, res *http.Response, err error) {
+	defer func() {
+		r.finish(err)
+	}()
+
+	if !r.OK() {
+		return nil, nil, fmt.Errorf("could not perform request: %w", r.multiErr)
+	}
+
+	// the trace is added to the request's context, so it is part of the
+	// context the request is sent with
+	defer func(ctx context.Context) {
+		r.context = ctx
+	}(r.context)
+	r.context = httptrace.WithClientTrace(r.context, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn = info.Conn
+		},
+	})
+
+	timeout, cancel := r.timeoutContext()
+	defer cancel()
+
+	res, err = r.perform(timeout, func() (*http.Request, error) {
+		req, err := r.newRequest()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", protocol)
+		return req, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	r.response = res
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+		if err := r.handleResponse(timeout, res, nil); err != nil {
+			return nil, res, err
+		}
+		return nil, res, fmt.Errorf("expected status %d when upgrading, got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	body, ok := res.Body.(io.ReadWriteCloser)
+	if !ok || conn == nil {
+		res.Body.Close()
+		return nil, res, fmt.Errorf("response body of type %T does not allow upgrading the connection", res.Body)
+	}
+	return &upgradedConn{conn, body}, res, nil
+}
+
+// upgradedConn is a connection that has been upgraded to a different
+// protocol. All reads and writes have to pass through the response body, as
+// the transport might have buffered data already. The underlying connection
+// is used for addresses and deadlines only.
+type upgradedConn struct {
+	net.Conn
+	body io.ReadWriteCloser
+}
+
+func (u *upgradedConn) Read(p []byte) (int, error) {
+	return u.body.Read(p)
+}
+
+func (u *upgradedConn) Write(p []byte) (int, error) {
+	return u.body.Write(p)
+}
+
+func (u *upgradedConn) Close() error {
+	return u.body.Close()
+}
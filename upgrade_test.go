@@ -0,0 +1,67 @@
+package rekwest
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRekwest_Upgrade(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "bad upgrade request", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString(strings.ToUpper(line))
+		rw.Flush()
+	}))
+	defer ts.Close()
+
+	t.Run("ok", func(t *testing.T) {
+		conn, res, err := New(ts.URL).BearerToken("secret").Upgrade("echo")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		defer conn.Close()
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			t.Errorf("Expected status 101, got %d", res.StatusCode)
+		}
+		if conn.RemoteAddr() == nil {
+			t.Error("Expected remote address")
+		}
+		if _, err := io.WriteString(conn, "platypus\n"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if line != "PLATYPUS\n" {
+			t.Errorf("Expected PLATYPUS, got %s", line)
+		}
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		conn, res, err := New(ts.URL).Upgrade("echo")
+		if conn != nil {
+			t.Error("Expected nil connection")
+		}
+		if err == nil || err.Error() != "request failed with status 400: bad upgrade request\n" {
+			t.Errorf("Unexpected error %v", err)
+		}
+		if res == nil || res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Unexpected response %v", res)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package rekwest
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// structValues encodes the exported fields of the given struct into
+// url.Values using the names in the first of the given struct tag keys a
+// field is tagged with. Zero values of
+// fields tagged `omitempty` and nil pointers are skipped, slices and arrays
+// result in repeated keys. An error is returned for each field of an
+// unsupported kind.
+func structValues(data interface{}, tagKeys ...string) (url.Values, []error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return url.Values{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, []error{fmt.Errorf("expected struct when encoding values, got %v", v.Kind())}
+	}
+	values := url.Values{}
+	return values, structFieldValues(v, tagKeys, values)
+}
+
+func structFieldValues(v reflect.Value, tagKeys []string, values url.Values) []error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := fieldTag(field, tagKeys)
+		if tag == "-" {
+			continue
+		}
+		name, omitEmpty := parseTag(tag)
+		value := v.Field(i)
+
+		if field.Anonymous && name == "" {
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct && !value.Type().Implements(textMarshalerType) {
+				errs = append(errs, structFieldValues(value, tagKeys, values)...)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		// unlike encoding/json, zero structs like time.Time are omitted too
+		if omitEmpty && (isEmptyValue(value) || value.Kind() == reflect.Struct && value.IsZero()) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+			for j := 0; j < value.Len(); j++ {
+				s, ok, err := formatValue(value.Index(j))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("cannot encode field %s: %w", field.Name, err))
+					break
+				}
+				if ok {
+					values.Add(name, s)
+				}
+			}
+			continue
+		}
+		s, ok, err := formatValue(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot encode field %s: %w", field.Name, err))
+			continue
+		}
+		if ok {
+			values.Add(name, s)
+		}
+	}
+	return errs
+}
+
+// fieldTag returns the value of the first of the given struct tag keys the
+// field is tagged with.
+func fieldTag(field reflect.StructField, tagKeys []string) string {
+	for _, key := range tagKeys {
+		if tag, ok := field.Tag.Lookup(key); ok {
+			return tag
+		}
+	}
+	return ""
+}
+
+// formatValue formats the given scalar value, reporting false in case it is
+// a nil pointer that should be skipped.
+func formatValue(v reflect.Value) (string, bool, error) {
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		return formatValue(v.Elem())
+	}
+	if v.CanInterface() {
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			if err != nil {
+				return "", false, err
+			}
+			return string(b), true, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), true, nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true, nil
+	default:
+		return "", false, fmt.Errorf("unsupported kind %v", v.Kind())
+	}
+}
+
+func (r *request) QueryStruct(data interface{}) Rekwest {
+	values, errs := structValues(data, "url")
+	r.buildError(errs...)
+	for key, vs := range values {
+		for _, value := range vs {
+			r.Query(key, value)
+		}
+	}
+	return r
+}
+
+func (r *request) FormStruct(data interface{}) Rekwest {
+	values, errs := structValues(data, "form", "url")
+	r.buildError(errs...)
+	return r.FormBody(values)
+}
@@ -0,0 +1,172 @@
+package rekwest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type pagination struct {
+	Page     int `url:"page"`
+	PageSize int `url:"page_size,omitempty"`
+}
+
+type animalFilter struct {
+	pagination
+	Kind     string    `url:"kind"`
+	Tags     []string  `url:"tag,omitempty"`
+	Flappers *bool     `url:"flappers"`
+	Weight   float64   `url:"weight,omitempty"`
+	Since    time.Time `url:"since,omitempty"`
+	Ignored  string    `url:"-"`
+	Name     string
+	internal string
+}
+
+func TestRekwest_QueryStruct(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer ts.Close()
+
+	flappers := true
+	tests := []struct {
+		name     string
+		data     interface{}
+		expected string
+	}{
+		{
+			"zero values",
+			animalFilter{},
+			"Name=&kind=&page=0",
+		},
+		{
+			"all fields",
+			&animalFilter{
+				pagination: pagination{2, 50},
+				Kind:       "platypus",
+				Tags:       []string{"mammal", "oviparous"},
+				Flappers:   &flappers,
+				Weight:     1.5,
+				Since:      time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				Ignored:    "ignored",
+				Name:       "perry",
+				internal:   "internal",
+			},
+			"Name=perry&flappers=true&kind=platypus&page=2&page_size=50&since=2020-01-02T03%3A04%3A05Z&tag=mammal&tag=oviparous&weight=1.5",
+		},
+		{
+			"nil",
+			(*animalFilter)(nil),
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data []byte
+			if err := New(ts.URL).QueryStruct(test.data).Do(&data); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(data) != test.expected {
+				t.Errorf("Expected query %q, got %q", test.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestRekwest_FormStruct(t *testing.T) {
+	var contentType string
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		form = r.PostForm
+	}))
+	defer ts.Close()
+
+	type signup struct {
+		pagination
+		User     string   `form:"user"`
+		Password string   `form:"password" url:"ignored"`
+		Tags     []string `url:"tag"`
+		Query    string   `form:"-" url:"query"`
+	}
+	err := New(ts.URL).
+		Method(http.MethodPost).
+		FormStruct(signup{
+			pagination: pagination{Page: 2},
+			User:       "platypus",
+			Password:   "secret",
+			Tags:       []string{"mammal", "oviparous"},
+			Query:      "skipped",
+		}).
+		Do()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Unexpected content type %v", contentType)
+	}
+	expected := url.Values{
+		"page":     {"2"},
+		"user":     {"platypus"},
+		"password": {"secret"},
+		"tag":      {"mammal", "oviparous"},
+	}
+	if !reflect.DeepEqual(expected, form) {
+		t.Errorf("Expected form %v, got %v", expected, form)
+	}
+
+	err = New(ts.URL).Method(http.MethodPost).FormStruct("platypus").Do()
+	var multiErr MultiError
+	if !errors.As(err, &multiErr) || len(multiErr.BuildErrors()) != 1 {
+		t.Errorf("Expected a single build error, got %v", err)
+	}
+}
+
+func TestRekwest_QueryStructErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     interface{}
+		expected []string
+	}{
+		{
+			"unsupported kinds",
+			struct {
+				Filter map[string]string `url:"filter"`
+				Nested []struct{}        `url:"nested"`
+			}{Nested: []struct{}{{}}},
+			[]string{"cannot encode field Filter: unsupported kind map", "cannot encode field Nested: unsupported kind struct"},
+		},
+		{
+			"no struct",
+			"platypus",
+			[]string{"expected struct when encoding values, got string"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := New("http://www.example.com").QueryStruct(test.data).Do()
+			var multiErr MultiError
+			if !errors.As(err, &multiErr) {
+				t.Fatalf("Expected MultiError, got %v", err)
+			}
+			build := multiErr.BuildErrors()
+			if len(build) != len(test.expected) {
+				t.Fatalf("Expected %d build errors, got %v", len(test.expected), build)
+			}
+			for i, err := range build {
+				if err.Error() != test.expected[i] {
+					t.Errorf("Expected %q, got %q", test.expected[i], err.Error())
+				}
+			}
+		})
+	}
+}